@@ -0,0 +1,28 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"maas/internal/config"
+
+	"gopkg.in/yaml.v2"
+)
+
+const configUsage = "usage: maas [flags] config print"
+
+// runConfig implements the `maas config` subcommand.
+func runConfig(cfg *config.Config, args []string) error {
+	if len(args) != 1 || args[0] != "print" {
+		return errors.New(configUsage)
+	}
+
+	// Print the effective configuration, after every layer has been applied.
+	out, err := yaml.Marshal(cfg.Redacted())
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprint(os.Stdout, string(out))
+	return err
+}
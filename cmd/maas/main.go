@@ -1,13 +1,24 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 
 	"maas/internal/config"
+	"maas/internal/logging"
+	"maas/internal/ratelimit"
 	"maas/internal/store"
+	"maas/internal/tracing"
 	"maas/pkg/api"
 	"maas/pkg/repository"
 	"maas/pkg/service"
@@ -16,27 +27,111 @@ import (
 )
 
 func main() {
-	// Load configuration
-	cfg, err := config.LoadConfig("config.yaml") // Assuming you have a config.yaml file
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run starts the server, or runs a subcommand, and returns when it is done.
+// Returning rather than exiting lets deferred cleanup such as closing the
+// database run.
+func run() error {
+	// Load configuration: defaults, then the YAML file, then MAAS_*
+	// environment variables, then flags
+	cfg, args, err := config.Load(os.Args[1:], os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error loading config: %w", err)
+	}
+
+	// Handle the config subcommand, which needs no database
+	if len(args) > 0 && args[0] == "config" {
+		return runConfig(cfg, args[1:])
+	}
+
+	// Report every configuration problem before touching the database
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	// Log structured records from here on. The standard logger is routed
+	// through the same handler.
+	logger, err := logging.New(cfg.Log, os.Stderr)
 	if err != nil {
-		log.Fatal("Error loading config:", err)
+		return fmt.Errorf("error setting up logging: %w", err)
 	}
+	slog.SetDefault(logger)
+
+	// Every shutdown step shares one deadline, started by the first step
+	deadline := &shutdownDeadline{timeout: time.Duration(cfg.Server.ShutdownTimeout) * time.Second}
+	defer deadline.stop()
+
+	// Set up tracing, flushing any buffered spans on exit
+	shutdownTracing, err := tracing.Setup(cfg.Tracing)
+	if err != nil {
+		return fmt.Errorf("error setting up tracing: %w", err)
+	}
+	defer func() {
+		if err := shutdownTracing(deadline.context()); err != nil {
+			slog.Error("Error flushing traces", "error", err)
+		}
+	}()
 
 	// Initialize the database
 	db, err := store.NewDB(cfg.Database)
 	if err != nil {
-		log.Fatal("Error initializing database:", err)
+		return fmt.Errorf("error initializing database: %w", err)
 	}
 	defer db.Close()
 
+	// Handle the migrate subcommand instead of starting the server
+	if len(args) > 0 && args[0] == "migrate" {
+		if err := runMigrate(db, args[1:]); err != nil {
+			return fmt.Errorf("error running migrations: %w", err)
+		}
+		return nil
+	}
+
+	if len(args) > 0 {
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+
+	// Refuse to start against an out-of-date schema
+	migrator, err := store.NewMigrator(db)
+	if err != nil {
+		return fmt.Errorf("error loading migrations: %w", err)
+	}
+	if err := migrator.Check(); err != nil {
+		return fmt.Errorf("error checking database schema: %w", err)
+	}
+
 	// Initialize repository, service, and API handler
-	memeRepo := repository.NewMemeRepository(db)
-	memeService := service.NewMemeService(memeRepo)
-	memeHandler := api.NewMemeHandler(memeService)
+	balanceCache := repository.NewBalanceCache(cfg.BalanceCache)
+	callLogger := repository.NewCallLogger(db, cfg.CallLog)
+	defer func() {
+		// Write the calls still queued once requests have drained
+		if err := callLogger.Close(deadline.context()); err != nil {
+			slog.Error("Error flushing API call log", "error", err)
+		}
+	}()
+	memeRepo := repository.NewMemeRepository(db, balanceCache, callLogger)
+	memeService := service.NewMemeService(memeRepo, cfg.Tokens)
+	metrics := api.NewMetrics(db, callLogger)
+	memeHandler := api.NewMemeHandler(api.InstrumentMemeService(memeService, metrics), ratelimit.NewMemory(cfg.RateLimit), cfg.Tokens)
+	clientRepo := repository.NewClientRepository(db, balanceCache)
+	clientService := service.NewClientService(clientRepo)
+	adminHandler := api.NewAdminHandler(clientService, db, cfg.Admin)
+	healthHandler := api.NewHealthHandler(db)
 
 	// Set up the router and middleware
 	r := mux.NewRouter()
+	r.Use(api.TracingMiddleware)
 	api.RegisterRoutes(r, memeHandler)
+	api.RegisterAdminRoutes(r, adminHandler)
+	api.RegisterHealthRoutes(r, healthHandler)
+	api.RegisterMetricsRoutes(r, metrics)
 
 	// Start the server
 	srv := &http.Server{
@@ -46,6 +141,57 @@ func main() {
 		ReadTimeout:  time.Duration(cfg.Server.ReadTimeout) * time.Second,
 	}
 
-	log.Printf("Starting server on port %d", cfg.Server.Port)
-	log.Fatal(srv.ListenAndServe())
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		slog.Info("Starting server", "port", cfg.Server.Port)
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		return fmt.Errorf("error running server: %w", err)
+	case <-ctx.Done():
+	}
+
+	// Fail readiness checks so load balancers stop routing here, keep
+	// serving while they notice, then stop taking new requests and let
+	// in-flight ones finish
+	stop()
+	slog.Info("Shutting down; draining requests", "drain_delay_seconds", cfg.Server.DrainDelay, "timeout_seconds", cfg.Server.ShutdownTimeout)
+	healthHandler.ShuttingDown()
+	time.Sleep(time.Duration(cfg.Server.DrainDelay) * time.Second)
+
+	if err := srv.Shutdown(deadline.context()); err != nil {
+		return fmt.Errorf("error shutting down server: %w", err)
+	}
+
+	slog.Info("Server stopped")
+	return nil
+}
+
+// shutdownDeadline bounds the whole shutdown: stopping the server, flushing
+// the call log and flushing traces share a single deadline rather than each
+// getting the full timeout.
+type shutdownDeadline struct {
+	timeout time.Duration
+	once    sync.Once
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+// context returns the shutdown context, starting the deadline on first use.
+func (d *shutdownDeadline) context() context.Context {
+	d.once.Do(func() {
+		d.ctx, d.cancel = context.WithTimeout(context.Background(), d.timeout)
+	})
+	return d.ctx
+}
+
+// stop releases the deadline's resources.
+func (d *shutdownDeadline) stop() {
+	d.context()
+	d.cancel()
 }
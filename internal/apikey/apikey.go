@@ -0,0 +1,111 @@
+// Package apikey issues and verifies client API keys.
+//
+// Keys have the form maas_<prefix>_<secret>. The prefix is stored in clear
+// and used to look the client up; the secret is only ever stored as a salted
+// SHA-256 hash.
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"strings"
+)
+
+const (
+	keyScheme    = "maas"
+	prefixBytes  = 6
+	secretBytes  = 24
+	saltBytes    = 16
+	legacyPrefix = "legacy-"
+)
+
+// Key is a newly issued API key together with what needs to be stored.
+type Key struct {
+	Token  string // Full key, shown to the client once and never stored
+	Prefix string
+	Salt   []byte
+	Hash   []byte
+}
+
+// Generate issues a new random API key.
+func Generate() (Key, error) {
+	prefix, err := randomHex(prefixBytes)
+	if err != nil {
+		return Key{}, err
+	}
+	secret, err := randomHex(secretBytes)
+	if err != nil {
+		return Key{}, err
+	}
+
+	token := keyScheme + "_" + prefix + "_" + secret
+	return Rehash(token)
+}
+
+// Rehash derives the stored form of an existing token, under a fresh salt.
+// It is used to migrate plaintext tokens that predate hashed keys.
+func Rehash(token string) (Key, error) {
+	salt := make([]byte, saltBytes)
+	if _, err := rand.Read(salt); err != nil {
+		return Key{}, err
+	}
+
+	prefix, secret := Parse(token)
+	return Key{
+		Token:  token,
+		Prefix: prefix,
+		Salt:   salt,
+		Hash:   Hash(salt, secret),
+	}, nil
+}
+
+// Parse splits a token into its lookup prefix and secret. Tokens that are not
+// in the maas_<prefix>_<secret> form are treated as legacy tokens: the whole
+// token is the secret and the prefix is derived from its digest.
+func Parse(token string) (prefix, secret string) {
+	parts := strings.SplitN(token, "_", 3)
+	if len(parts) == 3 && parts[0] == keyScheme && isHex(parts[1], prefixBytes*2) && parts[2] != "" {
+		return parts[1], parts[2]
+	}
+
+	sum := sha256.Sum256([]byte(token))
+	return legacyPrefix + hex.EncodeToString(sum[:8]), token
+}
+
+// IsLegacy reports whether token predates the maas_<prefix>_<secret> form.
+func IsLegacy(token string) bool {
+	prefix, _ := Parse(token)
+	return strings.HasPrefix(prefix, legacyPrefix)
+}
+
+// Hash returns the salted hash of a key secret.
+func Hash(salt []byte, secret string) []byte {
+	h := sha256.New()
+	h.Write(salt)
+	h.Write([]byte(secret))
+	return h.Sum(nil)
+}
+
+// Verify reports whether secret matches the stored salt and hash, in constant
+// time.
+func Verify(salt, hash []byte, secret string) bool {
+	return subtle.ConstantTimeCompare(Hash(salt, secret), hash) == 1
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func isHex(s string, length int) bool {
+	if len(s) != length {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
@@ -0,0 +1,56 @@
+package apikey
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerate(t *testing.T) {
+	key, err := Generate()
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(key.Token, "maas_"+key.Prefix+"_"))
+	assert.False(t, IsLegacy(key.Token))
+
+	prefix, secret := Parse(key.Token)
+	assert.Equal(t, key.Prefix, prefix)
+	assert.True(t, Verify(key.Salt, key.Hash, secret))
+	assert.False(t, Verify(key.Salt, key.Hash, secret+"x"))
+
+	other, err := Generate()
+	require.NoError(t, err)
+	assert.NotEqual(t, key.Token, other.Token)
+	assert.NotEqual(t, key.Prefix, other.Prefix)
+}
+
+func TestParseLegacyToken(t *testing.T) {
+	for _, token := range []string{"test_token", "maas_short_secret", "maas_0123456789ab_"} {
+		t.Run(token, func(t *testing.T) {
+			prefix, secret := Parse(token)
+			assert.True(t, IsLegacy(token))
+			assert.True(t, strings.HasPrefix(prefix, legacyPrefix))
+			assert.Equal(t, token, secret)
+
+			// The derived prefix must be stable so the client can be found again.
+			again, _ := Parse(token)
+			assert.Equal(t, prefix, again)
+		})
+	}
+}
+
+func TestRehash(t *testing.T) {
+	key, err := Rehash("test_token")
+	require.NoError(t, err)
+
+	prefix, secret := Parse("test_token")
+	assert.Equal(t, prefix, key.Prefix)
+	assert.True(t, Verify(key.Salt, key.Hash, secret))
+
+	// A fresh salt means the same token never hashes the same way twice.
+	again, err := Rehash("test_token")
+	require.NoError(t, err)
+	assert.NotEqual(t, key.Hash, again.Hash)
+}
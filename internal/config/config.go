@@ -1,54 +1,214 @@
 package config
 
 import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
 	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
 
 	"gopkg.in/yaml.v2"
 )
 
+// DefaultPath is the configuration file read when no --config flag is given.
+const DefaultPath = "config.yaml"
+
+// EnvPrefix prefixes the environment variables that override settings.
+const EnvPrefix = "MAAS_"
+
+// redacted replaces secret values in printed configuration.
+const redacted = "[REDACTED]"
+
 // Config represents the application configuration.
 type Config struct {
-	Server   ServerConfig   `yaml:"server"`
-	Database DatabaseConfig `yaml:"database"`
+	Server       ServerConfig       `yaml:"server"`
+	Database     DatabaseConfig     `yaml:"database"`
+	Tokens       TokensConfig       `yaml:"tokens"`
+	Admin        AdminConfig        `yaml:"admin"`
+	RateLimit    RateLimitConfig    `yaml:"rateLimit"`
+	BalanceCache BalanceCacheConfig `yaml:"balanceCache"`
+	CallLog      CallLogConfig      `yaml:"callLog"`
+	Tracing      TracingConfig      `yaml:"tracing"`
+	Log          LogConfig          `yaml:"log"`
 }
 
 // ServerConfig represents the server configuration.
 type ServerConfig struct {
-	Port         int `yaml:"port"`
-	WriteTimeout int `yaml:"writeTimeout"`
-	ReadTimeout  int `yaml:"readTimeout"`
+	Port            int `yaml:"port"`
+	WriteTimeout    int `yaml:"writeTimeout"`
+	ReadTimeout     int `yaml:"readTimeout"`
+	ShutdownTimeout int `yaml:"shutdownTimeout"` // Seconds shutdown may take once requests stop being accepted
+	DrainDelay      int `yaml:"drainDelay"`      // Seconds /readyz fails before requests stop being accepted
 }
 
 // DatabaseConfig represents the database configuration.
 type DatabaseConfig struct {
-	Host     string `yaml:"host"`
-	Port     int    `yaml:"port"`
-	User     string `yaml:"user"`
-	Password string `yaml:"password"`
-	DBName   string `yaml:"dbname"`
+	// DSN is a full connection string, either a postgres:// URL or
+	// key=value pairs. When set, it replaces the connection fields below.
+	DSN string `yaml:"dsn" secret:"true"`
+
+	Host        string `yaml:"host"`
+	Port        int    `yaml:"port"`
+	User        string `yaml:"user"`
+	Password    string `yaml:"password" secret:"true"`
+	DBName      string `yaml:"dbname"`
+	SSLMode     string `yaml:"sslmode"`     // One of SSLModes
+	SSLRootCert string `yaml:"sslrootcert"` // CA certificate file for verify-ca and verify-full
+	SSLCert     string `yaml:"sslcert"`     // Client certificate file
+	SSLKey      string `yaml:"sslkey"`      // Client private key file
+
+	ConnectTimeout      int `yaml:"connectTimeout"`      // Seconds to wait for a connection; 0 waits indefinitely
+	ConnectRetryTimeout int `yaml:"connectRetryTimeout"` // Seconds to keep retrying the database at startup; 0 tries once
+	MaxOpenConns        int `yaml:"maxOpenConns"`        // 0 means unlimited
+	MaxIdleConns        int `yaml:"maxIdleConns"`        // 0 keeps no idle connections
+	ConnMaxLifetime     int `yaml:"connMaxLifetime"`     // Seconds a connection is reused; 0 reuses forever
 }
 
-// LoadConfig loads the configuration from a YAML file.
-func LoadConfig(filepath string) (*Config, error) {
-	// Create a new Config instance with default values
-	cfg := &Config{
+// SSLModes are the sslmode values the PostgreSQL driver accepts.
+var SSLModes = []string{"disable", "require", "verify-ca", "verify-full"}
+
+// TokensConfig represents the token management configuration.
+type TokensConfig struct {
+	IdempotencyTTL int `yaml:"idempotencyTTL"` // Seconds an Idempotency-Key is remembered
+	MaxAmount      int `yaml:"maxAmount"`      // Largest amount a client may add in one request
+}
+
+// AdminConfig represents the admin API configuration.
+type AdminConfig struct {
+	Token string `yaml:"token" secret:"true"` // Credential for /admin routes; the admin API is disabled when empty
+}
+
+// RateLimitConfig represents the default per-client request rate limit.
+// Clients with limits of their own in the database are not bound by it.
+type RateLimitConfig struct {
+	RequestsPerMinute int `yaml:"requestsPerMinute"` // Sustained request rate; 0 disables the default limit
+	Burst             int `yaml:"burst"`             // Requests a client may make at once before being held to the rate
+}
+
+// BalanceCacheConfig represents the in-process cache of authenticated
+// clients and their balances.
+type BalanceCacheConfig struct {
+	Size int `yaml:"size"` // API keys cached at most; 0 disables the cache
+	TTL  int `yaml:"ttl"`  // Seconds a key is trusted before it is checked against the database again
+}
+
+// CallLogConfig represents the asynchronous logging of API calls to the
+// api_calls table.
+type CallLogConfig struct {
+	QueueSize     int    `yaml:"queueSize"`     // Calls held in memory waiting to be written
+	BatchSize     int    `yaml:"batchSize"`     // Calls written per INSERT at most
+	FlushInterval int    `yaml:"flushInterval"` // Milliseconds a call waits at most for its batch to fill
+	Overflow      string `yaml:"overflow"`      // One of CallLogOverflows
+}
+
+// What to do with a call when the call log queue is full.
+const (
+	CallLogOverflowBlock = "block" // Make the request wait for room
+	CallLogOverflowDrop  = "drop"  // Discard the call
+)
+
+// CallLogOverflows are the supported callLog.overflow values.
+var CallLogOverflows = []string{CallLogOverflowBlock, CallLogOverflowDrop}
+
+// MaxCallLogBatchSize bounds callLog.batchSize, keeping each INSERT within
+// PostgreSQL's limit on query parameters.
+const MaxCallLogBatchSize = 10000
+
+// TracingConfig represents the OpenTelemetry tracing configuration.
+type TracingConfig struct {
+	Exporter    string `yaml:"exporter"`    // One of TracingExporters
+	Endpoint    string `yaml:"endpoint"`    // OTLP/HTTP collector URL; defaults to the OTEL_EXPORTER_OTLP_* variables
+	ServiceName string `yaml:"serviceName"` // Reported as service.name
+}
+
+// Tracing exporters.
+const (
+	TracingExporterNone   = "none"
+	TracingExporterStdout = "stdout"
+	TracingExporterOTLP   = "otlp"
+)
+
+// TracingExporters are the supported tracing.exporter values.
+var TracingExporters = []string{TracingExporterNone, TracingExporterStdout, TracingExporterOTLP}
+
+// LogConfig represents the logging configuration.
+type LogConfig struct {
+	Level  string `yaml:"level"`  // One of LogLevels
+	Format string `yaml:"format"` // One of LogFormats
+}
+
+// Log formats.
+const (
+	LogFormatJSON = "json"
+	LogFormatText = "text"
+)
+
+// LogLevels are the supported log.level values.
+var LogLevels = []string{"debug", "info", "warn", "error"}
+
+// LogFormats are the supported log.format values.
+var LogFormats = []string{LogFormatJSON, LogFormatText}
+
+// defaults returns the configuration used for settings the file, the
+// environment and the flags leave unset.
+func defaults() *Config {
+	return &Config{
 		Server: ServerConfig{
-			Port:         8000,
-			WriteTimeout: 15,
-			ReadTimeout:  15,
+			Port:            8000,
+			WriteTimeout:    15,
+			ReadTimeout:     15,
+			ShutdownTimeout: 30,
+			DrainDelay:      5,
+		},
+		Database: DatabaseConfig{
+			Host:                "localhost",
+			Port:                5432,
+			SSLMode:             "disable",
+			ConnectTimeout:      5,
+			ConnectRetryTimeout: 60,
+			MaxOpenConns:        20,
+			MaxIdleConns:        10,
+			ConnMaxLifetime:     1800,
+		},
+		Tokens: TokensConfig{
+			IdempotencyTTL: 86400,
+			MaxAmount:      1000000,
+		},
+		RateLimit: RateLimitConfig{
+			RequestsPerMinute: 60,
+			Burst:             10,
+		},
+		BalanceCache: BalanceCacheConfig{
+			Size: 10000,
+			TTL:  30,
+		},
+		CallLog: CallLogConfig{
+			QueueSize:     10000,
+			BatchSize:     500,
+			FlushInterval: 1000,
+			Overflow:      CallLogOverflowBlock,
+		},
+		Tracing: TracingConfig{
+			Exporter:    TracingExporterNone,
+			ServiceName: "maas",
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: LogFormatJSON,
 		},
 		// Set other default values as necessary
 	}
+}
 
-	// Check if the config file exists
-	if _, err := os.Stat(filepath); err != nil {
-		if os.IsNotExist(err) {
-			// Config file does not exist, return config with default values
-			return cfg, nil
-		}
-		// Error occurred while checking the file
-		return nil, err
-	}
+// LoadConfig loads the configuration from a YAML file, with defaults for
+// the settings it leaves out. The file must exist.
+func LoadConfig(filepath string) (*Config, error) {
+	cfg := defaults()
 
 	// Read the config file
 	file, err := os.ReadFile(filepath)
@@ -64,3 +224,233 @@ func LoadConfig(filepath string) (*Config, error) {
 
 	return cfg, nil
 }
+
+// ValidationError lists every problem found in a configuration.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// Validate checks the configuration for missing or out-of-range settings.
+// It reports every problem at once, as a *ValidationError.
+func (c *Config) Validate() error {
+	var problems []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(validPort(c.Server.Port), "server.port must be between 1 and 65535, got %d", c.Server.Port)
+	check(c.Server.WriteTimeout > 0, "server.writeTimeout must be positive, got %d", c.Server.WriteTimeout)
+	check(c.Server.ReadTimeout > 0, "server.readTimeout must be positive, got %d", c.Server.ReadTimeout)
+	check(c.Server.ShutdownTimeout > 0, "server.shutdownTimeout must be positive, got %d", c.Server.ShutdownTimeout)
+	check(c.Server.DrainDelay >= 0, "server.drainDelay must not be negative, got %d", c.Server.DrainDelay)
+
+	// A DSN carries its own connection settings.
+	if c.Database.DSN == "" {
+		check(c.Database.Host != "", "database.host is required")
+		check(validPort(c.Database.Port), "database.port must be between 1 and 65535, got %d", c.Database.Port)
+		check(c.Database.User != "", "database.user is required")
+		check(c.Database.DBName != "", "database.dbname is required")
+		check(contains(SSLModes, c.Database.SSLMode), "database.sslmode must be one of %s, got %q", strings.Join(SSLModes, ", "), c.Database.SSLMode)
+		check((c.Database.SSLCert == "") == (c.Database.SSLKey == ""), "database.sslcert and database.sslkey must be set together")
+		check(c.Database.ConnectTimeout >= 0, "database.connectTimeout must not be negative, got %d", c.Database.ConnectTimeout)
+	}
+	check(c.Database.ConnectRetryTimeout >= 0, "database.connectRetryTimeout must not be negative, got %d", c.Database.ConnectRetryTimeout)
+	check(c.Database.MaxOpenConns >= 0, "database.maxOpenConns must not be negative, got %d", c.Database.MaxOpenConns)
+	check(c.Database.MaxIdleConns >= 0, "database.maxIdleConns must not be negative, got %d", c.Database.MaxIdleConns)
+	check(c.Database.ConnMaxLifetime >= 0, "database.connMaxLifetime must not be negative, got %d", c.Database.ConnMaxLifetime)
+
+	check(c.Tokens.IdempotencyTTL > 0, "tokens.idempotencyTTL must be positive, got %d", c.Tokens.IdempotencyTTL)
+	// Balances are stored in 32-bit integer columns.
+	check(c.Tokens.MaxAmount > 0 && c.Tokens.MaxAmount <= math.MaxInt32, "tokens.maxAmount must be between 1 and %d, got %d", math.MaxInt32, c.Tokens.MaxAmount)
+
+	check(c.RateLimit.RequestsPerMinute >= 0, "rateLimit.requestsPerMinute must not be negative, got %d", c.RateLimit.RequestsPerMinute)
+	check(c.RateLimit.RequestsPerMinute == 0 || c.RateLimit.Burst > 0, "rateLimit.burst must be positive when rateLimit.requestsPerMinute is set, got %d", c.RateLimit.Burst)
+
+	check(c.BalanceCache.Size >= 0, "balanceCache.size must not be negative, got %d", c.BalanceCache.Size)
+	check(c.BalanceCache.Size == 0 || c.BalanceCache.TTL > 0, "balanceCache.ttl must be positive when balanceCache.size is set, got %d", c.BalanceCache.TTL)
+
+	check(c.CallLog.QueueSize > 0, "callLog.queueSize must be positive, got %d", c.CallLog.QueueSize)
+	check(c.CallLog.BatchSize > 0 && c.CallLog.BatchSize <= MaxCallLogBatchSize, "callLog.batchSize must be between 1 and %d, got %d", MaxCallLogBatchSize, c.CallLog.BatchSize)
+	check(c.CallLog.FlushInterval > 0, "callLog.flushInterval must be positive, got %d", c.CallLog.FlushInterval)
+	check(contains(CallLogOverflows, c.CallLog.Overflow), "callLog.overflow must be one of %s, got %q", strings.Join(CallLogOverflows, ", "), c.CallLog.Overflow)
+
+	check(contains(TracingExporters, c.Tracing.Exporter), "tracing.exporter must be one of %s, got %q", strings.Join(TracingExporters, ", "), c.Tracing.Exporter)
+	check(c.Tracing.ServiceName != "", "tracing.serviceName is required")
+
+	check(contains(LogLevels, c.Log.Level), "log.level must be one of %s, got %q", strings.Join(LogLevels, ", "), c.Log.Level)
+	check(contains(LogFormats, c.Log.Format), "log.format must be one of %s, got %q", strings.Join(LogFormats, ", "), c.Log.Format)
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// validPort reports whether port is a usable TCP port number.
+func validPort(port int) bool {
+	return port >= 1 && port <= 65535
+}
+
+// contains reports whether values contains v.
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Load builds the configuration in layers: built-in defaults, then the YAML
+// file, then MAAS_* environment variables, then command-line flags. args are
+// the command-line arguments without the program name; flags must precede
+// any subcommand, and the arguments left after the flags are returned. A
+// missing file is only tolerated when --config was not given, so a mistyped
+// path is not silently replaced by the defaults.
+func Load(args []string, stderr io.Writer) (*Config, []string, error) {
+	fs := flag.NewFlagSet("maas", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	path := fs.String("config", DefaultPath, "path to the YAML configuration file")
+
+	// Each setting gets a flag; the values are applied once the lower layers
+	// have been loaded.
+	overrides := make(map[string]string)
+	for _, s := range settings() {
+		key := s.key
+		usage := fmt.Sprintf("overrides %s (env %s)", key, s.env)
+		fs.Func(key, usage, func(v string) error {
+			overrides[key] = v
+			return nil
+		})
+	}
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: maas [flags] [migrate ... | config print]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	explicit := false
+	fs.Visit(func(f *flag.Flag) {
+		explicit = explicit || f.Name == "config"
+	})
+	cfg, err := LoadConfig(*path)
+	if errors.Is(err, os.ErrNotExist) && !explicit {
+		cfg, err = defaults(), nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	v := reflect.ValueOf(cfg).Elem()
+	for _, s := range settings() {
+		if value, ok := os.LookupEnv(s.env); ok {
+			if err := s.set(v, value); err != nil {
+				return nil, nil, fmt.Errorf("environment variable %s: %w", s.env, err)
+			}
+		}
+	}
+	for _, s := range settings() {
+		if value, ok := overrides[s.key]; ok {
+			if err := s.set(v, value); err != nil {
+				return nil, nil, fmt.Errorf("flag --%s: %w", s.key, err)
+			}
+		}
+	}
+
+	return cfg, fs.Args(), nil
+}
+
+// Redacted returns a copy of the configuration with secrets masked, safe to
+// print or log.
+func (c Config) Redacted() Config {
+	v := reflect.ValueOf(&c).Elem()
+	for _, s := range settings() {
+		if !s.secret {
+			continue
+		}
+		if f := v.FieldByIndex(s.index); f.String() != "" {
+			f.SetString(redacted)
+		}
+	}
+	return c
+}
+
+// setting is one leaf of the configuration, addressable from the YAML file,
+// the environment and the command line.
+type setting struct {
+	key    string // Flag name, e.g. "server.writeTimeout"
+	env    string // Environment variable, e.g. "MAAS_SERVER_WRITE_TIMEOUT"
+	index  []int  // Field index path within Config
+	secret bool   // Masked by Redacted
+}
+
+// settings lists every setting of Config, in declaration order. Names are
+// derived from the yaml tags so the three layers never drift apart.
+func settings() []setting {
+	var out []setting
+	cfgType := reflect.TypeOf(Config{})
+	for i := 0; i < cfgType.NumField(); i++ {
+		section := cfgType.Field(i)
+		sectionName := yamlName(section)
+		for j := 0; j < section.Type.NumField(); j++ {
+			field := section.Type.Field(j)
+			name := yamlName(field)
+			out = append(out, setting{
+				key:    sectionName + "." + name,
+				env:    EnvPrefix + envName(sectionName) + "_" + envName(name),
+				index:  []int{i, j},
+				secret: field.Tag.Get("secret") == "true",
+			})
+		}
+	}
+	return out
+}
+
+// set parses value into the setting's field of v, which must be a Config.
+func (s setting) set(v reflect.Value, value string) error {
+	f := v.FieldByIndex(s.index)
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(value)
+	case reflect.Int:
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("%s must be an integer, got %q", s.key, value)
+		}
+		f.SetInt(int64(n))
+	default:
+		return fmt.Errorf("%s has unsupported type %s", s.key, f.Type())
+	}
+	return nil
+}
+
+// yamlName returns the YAML key of a struct field.
+func yamlName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+	if name == "" {
+		return strings.ToLower(f.Name)
+	}
+	return name
+}
+
+// envName converts a camelCase YAML key to SCREAMING_SNAKE_CASE, treating a
+// run of capitals as one word: "idempotencyTTL" becomes "IDEMPOTENCY_TTL".
+func envName(key string) string {
+	var b strings.Builder
+	runes := []rune(key)
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) && !unicode.IsUpper(runes[i-1]) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
@@ -0,0 +1,208 @@
+package config
+
+import (
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeConfigFile writes a YAML config file to a temporary directory.
+func writeConfigFile(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(contents), 0o600))
+	return path
+}
+
+func TestLoadLayers(t *testing.T) {
+	path := writeConfigFile(t, `
+server:
+  port: 9000
+  readTimeout: 20
+database:
+  host: yaml-host
+  user: yaml-user
+`)
+
+	t.Run("Defaults And File", func(t *testing.T) {
+		cfg, args, err := Load([]string{"--config", path}, io.Discard)
+		require.NoError(t, err)
+
+		assert.Empty(t, args)
+		assert.Equal(t, 9000, cfg.Server.Port)
+		assert.Equal(t, 20, cfg.Server.ReadTimeout)
+		assert.Equal(t, 15, cfg.Server.WriteTimeout) // Default
+		assert.Equal(t, "yaml-host", cfg.Database.Host)
+	})
+
+	t.Run("Environment Overrides File", func(t *testing.T) {
+		t.Setenv("MAAS_DATABASE_HOST", "env-host")
+		t.Setenv("MAAS_SERVER_WRITE_TIMEOUT", "30")
+		t.Setenv("MAAS_TOKENS_IDEMPOTENCY_TTL", "60")
+
+		cfg, _, err := Load([]string{"--config", path}, io.Discard)
+		require.NoError(t, err)
+
+		assert.Equal(t, "env-host", cfg.Database.Host)
+		assert.Equal(t, "yaml-user", cfg.Database.User)
+		assert.Equal(t, 30, cfg.Server.WriteTimeout)
+		assert.Equal(t, 60, cfg.Tokens.IdempotencyTTL)
+	})
+
+	t.Run("Flags Override Environment", func(t *testing.T) {
+		t.Setenv("MAAS_SERVER_PORT", "9100")
+
+		cfg, args, err := Load([]string{"--config", path, "--server.port", "9200", "migrate", "up"}, io.Discard)
+		require.NoError(t, err)
+
+		assert.Equal(t, 9200, cfg.Server.Port)
+		assert.Equal(t, []string{"migrate", "up"}, args)
+	})
+
+	t.Run("Invalid Environment Value", func(t *testing.T) {
+		t.Setenv("MAAS_SERVER_PORT", "eighty")
+
+		_, _, err := Load([]string{"--config", path}, io.Discard)
+		assert.EqualError(t, err, `environment variable MAAS_SERVER_PORT: server.port must be an integer, got "eighty"`)
+	})
+
+	t.Run("Invalid Flag Value", func(t *testing.T) {
+		_, _, err := Load([]string{"--config", path, "--server.port=eighty"}, io.Discard)
+		assert.EqualError(t, err, `flag --server.port: server.port must be an integer, got "eighty"`)
+	})
+
+	t.Run("Missing File", func(t *testing.T) {
+		_, _, err := Load([]string{"--config", filepath.Join(t.TempDir(), "absent.yaml")}, io.Discard)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("Missing Default File", func(t *testing.T) {
+		// Run where there is no config.yaml
+		wd, err := os.Getwd()
+		require.NoError(t, err)
+		require.NoError(t, os.Chdir(t.TempDir()))
+		defer os.Chdir(wd)
+
+		cfg, _, err := Load(nil, io.Discard)
+		require.NoError(t, err)
+
+		assert.Equal(t, 8000, cfg.Server.Port)
+	})
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := Config{
+		Database: DatabaseConfig{Host: "db", Password: "hunter2"},
+		Admin:    AdminConfig{Token: "admin_secret"},
+	}
+
+	out := cfg.Redacted()
+
+	assert.Equal(t, "db", out.Database.Host)
+	assert.Equal(t, redacted, out.Database.Password)
+	assert.Equal(t, redacted, out.Admin.Token)
+	assert.Equal(t, "hunter2", cfg.Database.Password) // The original is untouched
+
+	// An unset secret stays empty, so it is clear that none is configured.
+	assert.Empty(t, Config{}.Redacted().Admin.Token)
+}
+
+func TestEnvName(t *testing.T) {
+	tests := map[string]string{
+		"port":           "PORT",
+		"writeTimeout":   "WRITE_TIMEOUT",
+		"idempotencyTTL": "IDEMPOTENCY_TTL",
+		"dbname":         "DBNAME",
+	}
+	for key, want := range tests {
+		assert.Equal(t, want, envName(key), key)
+	}
+}
+
+// validConfig returns a configuration that passes Validate.
+func validConfig(t *testing.T) *Config {
+	t.Helper()
+	cfg := defaults()
+	cfg.Database.User = "maas"
+	cfg.Database.DBName = "maasdb"
+	return cfg
+}
+
+func TestValidate(t *testing.T) {
+	t.Run("Valid", func(t *testing.T) {
+		assert.NoError(t, validConfig(t).Validate())
+	})
+
+	t.Run("Shipped Config File", func(t *testing.T) {
+		cfg, err := LoadConfig("../../config.yaml")
+		require.NoError(t, err)
+		assert.NoError(t, cfg.Validate())
+	})
+
+	t.Run("DSN Replaces Connection Fields", func(t *testing.T) {
+		cfg := validConfig(t)
+		cfg.Database = DatabaseConfig{DSN: "postgres://maas@db/maasdb", MaxOpenConns: 10}
+		assert.NoError(t, cfg.Validate())
+
+		cfg.Database.MaxIdleConns = -1
+		assert.EqualError(t, cfg.Validate(), "invalid configuration:\n  - database.maxIdleConns must not be negative, got -1")
+	})
+
+	t.Run("Client Certificate Needs Key", func(t *testing.T) {
+		cfg := validConfig(t)
+		cfg.Database.SSLCert = "/etc/maas/client.pem"
+		assert.EqualError(t, cfg.Validate(), "invalid configuration:\n  - database.sslcert and database.sslkey must be set together")
+	})
+
+	t.Run("Max Amount Fits Balance Column", func(t *testing.T) {
+		cfg := validConfig(t)
+		cfg.Tokens.MaxAmount = math.MaxInt32
+		assert.NoError(t, cfg.Validate())
+
+		cfg.Tokens.MaxAmount = math.MaxInt32 + 1
+		assert.EqualError(t, cfg.Validate(), "invalid configuration:\n  - tokens.maxAmount must be between 1 and 2147483647, got 2147483648")
+	})
+
+	t.Run("Reports Every Problem", func(t *testing.T) {
+		cfg := validConfig(t)
+		cfg.Server.Port = 70000
+		cfg.Server.ReadTimeout = 0
+		cfg.Database.Host = ""
+		cfg.Database.Port = -1
+		cfg.Database.User = ""
+		cfg.Database.DBName = ""
+		cfg.Database.SSLMode = "prefer"
+		cfg.Tokens.MaxAmount = 0
+		cfg.RateLimit.Burst = 0
+		cfg.BalanceCache.Size = -1
+		cfg.CallLog.BatchSize = 20000
+		cfg.CallLog.Overflow = "spill"
+		cfg.Tracing.Exporter = "zipkin"
+
+		err := cfg.Validate()
+
+		var verr *ValidationError
+		require.ErrorAs(t, err, &verr)
+		assert.Equal(t, []string{
+			"server.port must be between 1 and 65535, got 70000",
+			"server.readTimeout must be positive, got 0",
+			"database.host is required",
+			"database.port must be between 1 and 65535, got -1",
+			"database.user is required",
+			"database.dbname is required",
+			`database.sslmode must be one of disable, require, verify-ca, verify-full, got "prefer"`,
+			"tokens.maxAmount must be between 1 and 2147483647, got 0",
+			"rateLimit.burst must be positive when rateLimit.requestsPerMinute is set, got 0",
+			"balanceCache.size must not be negative, got -1",
+			"callLog.batchSize must be between 1 and 10000, got 20000",
+			`callLog.overflow must be one of block, drop, got "spill"`,
+			`tracing.exporter must be one of none, stdout, otlp, got "zipkin"`,
+		}, verr.Problems)
+		assert.Contains(t, err.Error(), "invalid configuration:\n  - server.port must be between 1 and 65535, got 70000\n  - server.readTimeout")
+	})
+}
@@ -0,0 +1,39 @@
+// Package geo parses the coordinates clients send with their requests.
+package geo
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Point is a location in decimal degrees.
+type Point struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// ParseLatitude parses a latitude in decimal degrees.
+func ParseLatitude(s string) (float64, error) {
+	return parseDegrees(s, 90)
+}
+
+// ParseLongitude parses a longitude in decimal degrees.
+func ParseLongitude(s string) (float64, error) {
+	return parseDegrees(s, 180)
+}
+
+// parseDegrees parses a finite number of degrees no further than limit from
+// zero. Its errors describe the problem in a form suitable for clients.
+func parseDegrees(s string, limit float64) (float64, error) {
+	v, err := strconv.ParseFloat(s, 64)
+	if (err != nil && !errors.Is(err, strconv.ErrRange)) || math.IsNaN(v) {
+		return 0, errors.New("must be a number")
+	}
+	// Overflowing values parse as an infinity and fail the range check.
+	if math.Abs(v) > limit {
+		return 0, fmt.Errorf("must be between %g and %g", -limit, limit)
+	}
+	return v, nil
+}
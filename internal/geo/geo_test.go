@@ -0,0 +1,42 @@
+package geo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLatitude(t *testing.T) {
+	lat, err := ParseLatitude("40.730610")
+	assert.NoError(t, err)
+	assert.Equal(t, 40.730610, lat)
+
+	for _, s := range []string{"-90", "90"} {
+		_, err := ParseLatitude(s)
+		assert.NoError(t, err, s)
+	}
+
+	for s, msg := range map[string]string{
+		"":      "must be a number",
+		"north": "must be a number",
+		"NaN":   "must be a number",
+		"90.1":  "must be between -90 and 90",
+		"-Inf":  "must be between -90 and 90",
+		"1e400": "must be between -90 and 90",
+	} {
+		_, err := ParseLatitude(s)
+		assert.EqualError(t, err, msg, s)
+	}
+}
+
+func TestParseLongitude(t *testing.T) {
+	lon, err := ParseLongitude("-73.935242")
+	assert.NoError(t, err)
+	assert.Equal(t, -73.935242, lon)
+
+	_, err = ParseLongitude("180.5")
+	assert.EqualError(t, err, "must be between -180 and 180")
+
+	_, err = ParseLongitude("west")
+	assert.EqualError(t, err, "must be a number")
+}
@@ -0,0 +1,111 @@
+// Package logging sets up structured logging and carries per-request log
+// attributes, such as the request ID, through contexts.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+
+	"maas/internal/config"
+)
+
+// New creates a logger writing to w in the configured format, at or above
+// the configured level. Records logged with a context carry the request ID
+// stored in it by WithRequestID.
+func New(cfg config.LogConfig, w io.Writer) (*slog.Logger, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q", cfg.Level)
+	}
+	opts := &slog.HandlerOptions{Level: level}
+
+	var h slog.Handler
+	switch cfg.Format {
+	case config.LogFormatJSON:
+		h = slog.NewJSONHandler(w, opts)
+	case config.LogFormatText:
+		h = slog.NewTextHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("invalid log format %q", cfg.Format)
+	}
+	return slog.New(contextHandler{h}), nil
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying the request ID id.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID carried by ctx, or an empty string.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// annotations collects attributes for a request's access log line from the
+// layers that handle it.
+type annotations struct {
+	mu    sync.Mutex
+	attrs []slog.Attr
+}
+
+type annotationsKey struct{}
+
+// WithAnnotations returns a copy of ctx to which Annotate can add
+// attributes, and a function returning the attributes added so far.
+func WithAnnotations(ctx context.Context) (context.Context, func() []slog.Attr) {
+	a := &annotations{}
+	return context.WithValue(ctx, annotationsKey{}, a), func() []slog.Attr {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		return append([]slog.Attr(nil), a.attrs...)
+	}
+}
+
+// Annotate adds attrs to the access log line of the request ctx belongs to,
+// replacing any attribute already added with the same key. It does nothing
+// if ctx was not prepared by WithAnnotations.
+func Annotate(ctx context.Context, attrs ...slog.Attr) {
+	a, ok := ctx.Value(annotationsKey{}).(*annotations)
+	if !ok {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+next:
+	for _, attr := range attrs {
+		for i := range a.attrs {
+			if a.attrs[i].Key == attr.Key {
+				a.attrs[i] = attr
+				continue next
+			}
+		}
+		a.attrs = append(a.attrs, attr)
+	}
+}
+
+// contextHandler adds the request ID from the logging context to records.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,62 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"maas/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	t.Run("JSON With Request ID", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger, err := New(config.LogConfig{Level: "info", Format: config.LogFormatJSON}, &buf)
+		require.NoError(t, err)
+
+		logger.InfoContext(WithRequestID(context.Background(), "req-1"), "Hello", "answer", 42)
+
+		var record map[string]interface{}
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+		assert.Equal(t, "INFO", record["level"])
+		assert.Equal(t, "Hello", record["msg"])
+		assert.Equal(t, "req-1", record["request_id"])
+		assert.Equal(t, float64(42), record["answer"])
+	})
+
+	t.Run("Text Below Level", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger, err := New(config.LogConfig{Level: "warn", Format: config.LogFormatText}, &buf)
+		require.NoError(t, err)
+
+		logger.Info("Dropped")
+		logger.With("component", "test").Warn("Kept")
+
+		assert.NotContains(t, buf.String(), "Dropped")
+		assert.Contains(t, buf.String(), "level=WARN msg=Kept component=test")
+	})
+
+	t.Run("Invalid Settings", func(t *testing.T) {
+		_, err := New(config.LogConfig{Level: "loud", Format: config.LogFormatJSON}, &bytes.Buffer{})
+		assert.EqualError(t, err, `invalid log level "loud"`)
+
+		_, err = New(config.LogConfig{Level: "info", Format: "xml"}, &bytes.Buffer{})
+		assert.EqualError(t, err, `invalid log format "xml"`)
+	})
+}
+
+func TestAnnotate(t *testing.T) {
+	// Annotating a context without annotations is a no-op.
+	Annotate(context.Background(), slog.Int("client_id", 1))
+
+	ctx, annotations := WithAnnotations(context.Background())
+	Annotate(ctx, slog.Int("client_id", 7))
+	Annotate(ctx, slog.String("plan", "free"), slog.Int("client_id", 8))
+
+	assert.Equal(t, []slog.Attr{slog.Int("client_id", 8), slog.String("plan", "free")}, annotations())
+}
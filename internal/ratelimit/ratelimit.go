@@ -0,0 +1,135 @@
+// Package ratelimit limits how often clients may make requests, using a
+// token bucket per client.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"maas/internal/config"
+)
+
+// sweepInterval is how often idle buckets are discarded.
+const sweepInterval = time.Minute
+
+// Limit is the rate a client may make requests at. Zero fields fall back to
+// the configured default.
+type Limit struct {
+	RequestsPerMinute int // Sustained request rate
+	Burst             int // Requests that may be made at once
+}
+
+// Decision is the outcome of a request against a client's limit.
+type Decision struct {
+	Allowed    bool
+	Limit      int           // Size of the client's bucket; 0 when the client is not limited
+	Remaining  int           // Requests the client may make right now
+	Reset      time.Duration // Time until the bucket is full again
+	RetryAfter time.Duration // Time until a rejected request would be allowed
+}
+
+// bucket holds the tokens a client has left. Each request takes one token,
+// and tokens are replenished at the client's rate up to its burst.
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	limit   Limit
+}
+
+// Memory is a rate limiter that keeps its buckets in process memory. Limits
+// are not shared between replicas and are lost on restart. It is safe for
+// concurrent use.
+type Memory struct {
+	defaults Limit
+	now      func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// NewMemory creates an in-memory rate limiter applying cfg to clients
+// without limits of their own.
+func NewMemory(cfg config.RateLimitConfig) *Memory {
+	return &Memory{
+		defaults: Limit{RequestsPerMinute: cfg.RequestsPerMinute, Burst: cfg.Burst},
+		now:      time.Now,
+		buckets:  make(map[string]*bucket),
+	}
+}
+
+// Allow takes a token from the bucket for key, which is limited to limit,
+// and reports whether the request may proceed.
+func (m *Memory) Allow(key string, limit Limit) Decision {
+	limit = m.resolve(limit)
+	if limit.RequestsPerMinute == 0 {
+		return Decision{Allowed: true}
+	}
+	rate := float64(limit.RequestsPerMinute) / time.Minute.Seconds() // Tokens per second
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	if now.Sub(m.lastSweep) >= sweepInterval {
+		m.sweep(now)
+	}
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updated: now}
+		m.buckets[key] = b
+	} else {
+		b.tokens += now.Sub(b.updated).Seconds() * rate
+		b.updated = now
+	}
+	// A changed limit takes effect immediately.
+	b.limit = limit
+	b.tokens = math.Min(b.tokens, float64(limit.Burst))
+
+	d := Decision{Limit: limit.Burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		d.Allowed = true
+	} else {
+		d.RetryAfter = seconds((1 - b.tokens) / rate)
+	}
+	d.Remaining = int(b.tokens)
+	d.Reset = seconds((float64(limit.Burst) - b.tokens) / rate)
+	return d
+}
+
+// resolve fills the fields of limit left at zero from the defaults. A client
+// with a rate of its own but no burst takes the default burst, or may make
+// one request at a time when the default burst is zero too.
+func (m *Memory) resolve(limit Limit) Limit {
+	if limit.RequestsPerMinute == 0 {
+		limit.RequestsPerMinute = m.defaults.RequestsPerMinute
+	}
+	if limit.Burst == 0 {
+		limit.Burst = m.defaults.Burst
+	}
+	if limit.Burst == 0 {
+		limit.Burst = 1
+	}
+	return limit
+}
+
+// sweep discards the buckets that have refilled, which are no different
+// from new ones, so that clients who have gone away do not hold memory.
+// m.mu must be held.
+func (m *Memory) sweep(now time.Time) {
+	for key, b := range m.buckets {
+		rate := float64(b.limit.RequestsPerMinute) / time.Minute.Seconds()
+		if b.tokens+now.Sub(b.updated).Seconds()*rate >= float64(b.limit.Burst) {
+			delete(m.buckets, key)
+		}
+	}
+	m.lastSweep = now
+}
+
+// seconds converts a number of seconds to a duration.
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
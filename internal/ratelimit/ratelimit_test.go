@@ -0,0 +1,131 @@
+package ratelimit
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"maas/internal/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestMemory returns a limiter whose clock only moves when the returned
+// function is called.
+func newTestMemory(cfg config.RateLimitConfig) (*Memory, func(d time.Duration)) {
+	m := NewMemory(cfg)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	m.now = func() time.Time { return now }
+	return m, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestMemoryAllow(t *testing.T) {
+	t.Run("Burst Then Rate", func(t *testing.T) {
+		m, advance := newTestMemory(config.RateLimitConfig{RequestsPerMinute: 60, Burst: 3})
+
+		// The burst is available at once
+		for i := 2; i >= 0; i-- {
+			d := m.Allow("7", Limit{})
+			assert.True(t, d.Allowed)
+			assert.Equal(t, 3, d.Limit)
+			assert.Equal(t, i, d.Remaining)
+		}
+
+		// Then the client must wait for the bucket to refill
+		d := m.Allow("7", Limit{})
+		assert.False(t, d.Allowed)
+		assert.Equal(t, 0, d.Remaining)
+		assert.Equal(t, time.Second, d.RetryAfter)
+		assert.Equal(t, 3*time.Second, d.Reset)
+
+		advance(time.Second)
+		assert.True(t, m.Allow("7", Limit{}).Allowed)
+		assert.False(t, m.Allow("7", Limit{}).Allowed)
+	})
+
+	t.Run("Clients Are Limited Separately", func(t *testing.T) {
+		m, _ := newTestMemory(config.RateLimitConfig{RequestsPerMinute: 60, Burst: 1})
+
+		assert.True(t, m.Allow("7", Limit{}).Allowed)
+		assert.False(t, m.Allow("7", Limit{}).Allowed)
+		assert.True(t, m.Allow("8", Limit{}).Allowed)
+	})
+
+	t.Run("Client Limit Overrides Default", func(t *testing.T) {
+		m, advance := newTestMemory(config.RateLimitConfig{RequestsPerMinute: 60, Burst: 1})
+
+		d := m.Allow("7", Limit{RequestsPerMinute: 6, Burst: 5})
+		assert.True(t, d.Allowed)
+		assert.Equal(t, 5, d.Limit)
+		assert.Equal(t, 4, d.Remaining)
+		assert.Equal(t, 10*time.Second, d.Reset)
+
+		// Only the rate is set, so the default burst applies
+		m.Allow("8", Limit{RequestsPerMinute: 6})
+		d = m.Allow("8", Limit{RequestsPerMinute: 6})
+		assert.False(t, d.Allowed)
+		assert.Equal(t, 10*time.Second, d.RetryAfter)
+
+		advance(10 * time.Second)
+		assert.True(t, m.Allow("8", Limit{RequestsPerMinute: 6}).Allowed)
+	})
+
+	t.Run("Lowered Limit Applies Immediately", func(t *testing.T) {
+		m, _ := newTestMemory(config.RateLimitConfig{RequestsPerMinute: 60, Burst: 10})
+
+		assert.Equal(t, 9, m.Allow("7", Limit{}).Remaining)
+		assert.Equal(t, 1, m.Allow("7", Limit{Burst: 2}).Remaining)
+	})
+
+	t.Run("Unlimited", func(t *testing.T) {
+		m, _ := newTestMemory(config.RateLimitConfig{})
+
+		for i := 0; i < 100; i++ {
+			assert.Equal(t, Decision{Allowed: true}, m.Allow("7", Limit{}))
+		}
+		// A client limit still applies when there is no default
+		assert.True(t, m.Allow("8", Limit{RequestsPerMinute: 60}).Allowed)
+		assert.False(t, m.Allow("8", Limit{RequestsPerMinute: 60}).Allowed)
+	})
+}
+
+func TestMemorySweep(t *testing.T) {
+	m, advance := newTestMemory(config.RateLimitConfig{RequestsPerMinute: 6, Burst: 10})
+
+	m.Allow("7", Limit{})
+	advance(30 * time.Second)
+	for i := 0; i < 10; i++ {
+		m.Allow("8", Limit{})
+	}
+
+	// After the sweep interval only the drained bucket is kept
+	advance(sweepInterval - 5*time.Second)
+	m.Allow("9", Limit{})
+	assert.NotContains(t, m.buckets, "7")
+	assert.Contains(t, m.buckets, "8")
+	assert.Contains(t, m.buckets, "9")
+}
+
+func TestMemoryConcurrent(t *testing.T) {
+	m := NewMemory(config.RateLimitConfig{RequestsPerMinute: 1, Burst: 50})
+
+	var mu sync.Mutex
+	allowed := make(map[string]int)
+	var wg sync.WaitGroup
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := fmt.Sprint(i % 2)
+			if m.Allow(key, Limit{}).Allowed {
+				mu.Lock()
+				allowed[key]++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, map[string]int{"0": 50, "1": 50}, allowed)
+}
@@ -1,27 +1,200 @@
 package store
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"log/slog"
+	"math/rand"
+	"strings"
+	"time"
 
 	"maas/internal/config"
 
-	_ "github.com/lib/pq" // PostgreSQL driver
+	"github.com/lib/pq"
 )
 
-// NewDB creates a new database connection.
-func NewDB(cfg config.DatabaseConfig) (*sql.DB, error) {
-	dbInfo := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
-		cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.DBName)
+// Delays between attempts to reach the database at startup. The delay
+// doubles after each failed attempt, up to the maximum.
+const (
+	connectRetryInitialDelay = 500 * time.Millisecond
+	connectRetryMaxDelay     = 10 * time.Second
+)
 
-	db, err := sql.Open("postgres", dbInfo)
+// NewDB creates a new database connection pool. While the database cannot be
+// reached it keeps retrying, for up to cfg.ConnectRetryTimeout seconds, so
+// the service may start before PostgreSQL is ready. A malformed DSN, bad
+// credentials or a missing database fail at once, since waiting will not fix
+// them.
+func NewDB(cfg config.DatabaseConfig) (*sql.DB, error) {
+	connector, err := pq.NewConnector(DataSourceName(cfg))
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("invalid database connection settings: %w", err)
 	}
+	db := sql.OpenDB(connector)
+
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(time.Duration(cfg.ConnMaxLifetime) * time.Second)
 
-	if err = db.Ping(); err != nil {
+	retry := connectRetry{
+		timeout:      time.Duration(cfg.ConnectRetryTimeout) * time.Second,
+		initialDelay: connectRetryInitialDelay,
+		maxDelay:     connectRetryMaxDelay,
+		clock:        systemClock{},
+		jitter:       equalJitter,
+		logger:       slog.Default(),
+	}
+	if err = retry.ping(context.Background(), db); err != nil {
+		db.Close()
 		return nil, err
 	}
 
 	return db, nil
 }
+
+// pinger is the connection check connectRetry repeats.
+type pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// clock lets tests control the passage of time.
+type clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+}
+
+// systemClock is the real clock.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time        { return time.Now() }
+func (systemClock) Sleep(d time.Duration) { time.Sleep(d) }
+
+// connectRetry pings the database until it answers, backing off
+// exponentially between attempts, or until timeout has passed.
+type connectRetry struct {
+	timeout      time.Duration
+	initialDelay time.Duration
+	maxDelay     time.Duration
+	clock        clock
+	jitter       func(d time.Duration) time.Duration // Randomises a delay so restarting replicas do not retry in lockstep
+	logger       *slog.Logger
+}
+
+// ping pings db, retrying on failure. It returns the last ping error once
+// the timeout has passed, or straight away if the error is permanent.
+func (r connectRetry) ping(ctx context.Context, db pinger) error {
+	deadline := r.clock.Now().Add(r.timeout)
+	delay := r.initialDelay
+
+	for attempt := 1; ; attempt++ {
+		err := db.PingContext(ctx)
+		if err == nil {
+			if attempt > 1 {
+				r.logger.Info("Connected to the database", "attempts", attempt)
+			}
+			return nil
+		}
+
+		remaining := deadline.Sub(r.clock.Now())
+		if remaining <= 0 || permanent(err) {
+			if attempt > 1 {
+				return fmt.Errorf("database unreachable after %d attempts: %w", attempt, err)
+			}
+			return err
+		}
+
+		wait := r.jitter(delay)
+		if wait > remaining {
+			wait = remaining
+		}
+		r.logger.Warn("Database unreachable; retrying", "attempt", attempt, "error", err, "retry_in", wait.Round(time.Millisecond))
+		r.clock.Sleep(wait)
+
+		delay *= 2
+		if delay > r.maxDelay {
+			delay = r.maxDelay
+		}
+	}
+}
+
+// permanent reports whether a ping failed for a reason retrying cannot fix:
+// the server rejected the credentials (SQLSTATE class 28) or the database
+// does not exist (3D000).
+func permanent(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	return pqErr.Code.Class() == "28" || pqErr.Code == "3D000"
+}
+
+// equalJitter returns a random delay between d/2 and d.
+func equalJitter(d time.Duration) time.Duration {
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// DataSourceName returns the connection string for cfg: its DSN when one is
+// set, and otherwise key=value pairs built from the individual fields.
+func DataSourceName(cfg config.DatabaseConfig) string {
+	if cfg.DSN != "" {
+		return cfg.DSN
+	}
+
+	params := []string{
+		"host=" + quoteDSNValue(cfg.Host),
+		fmt.Sprintf("port=%d", cfg.Port),
+		"user=" + quoteDSNValue(cfg.User),
+		"password=" + quoteDSNValue(cfg.Password),
+		"dbname=" + quoteDSNValue(cfg.DBName),
+		"sslmode=" + quoteDSNValue(cfg.SSLMode),
+	}
+	if cfg.SSLRootCert != "" {
+		params = append(params, "sslrootcert="+quoteDSNValue(cfg.SSLRootCert))
+	}
+	if cfg.SSLCert != "" {
+		params = append(params, "sslcert="+quoteDSNValue(cfg.SSLCert), "sslkey="+quoteDSNValue(cfg.SSLKey))
+	}
+	if cfg.ConnectTimeout > 0 {
+		params = append(params, fmt.Sprintf("connect_timeout=%d", cfg.ConnectTimeout))
+	}
+	return strings.Join(params, " ")
+}
+
+// quoteDSNValue quotes a value for a key=value connection string, so that
+// passwords and paths may contain spaces, quotes and backslashes.
+func quoteDSNValue(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, `'`, `\'`)
+	return "'" + v + "'"
+}
+
+// PoolStats is a snapshot of the connection pool, for monitoring.
+type PoolStats struct {
+	MaxOpenConnections int   `json:"max_open_connections"` // 0 means unlimited
+	OpenConnections    int   `json:"open_connections"`
+	InUse              int   `json:"in_use"`
+	Idle               int   `json:"idle"`
+	WaitCount          int64 `json:"wait_count"`       // Total times a caller waited for a connection
+	WaitDurationMs     int64 `json:"wait_duration_ms"` // Total time spent waiting
+	MaxIdleClosed      int64 `json:"max_idle_closed"`
+	MaxIdleTimeClosed  int64 `json:"max_idle_time_closed"`
+	MaxLifetimeClosed  int64 `json:"max_lifetime_closed"`
+}
+
+// NewPoolStats converts the statistics reported by database/sql.
+func NewPoolStats(s sql.DBStats) PoolStats {
+	return PoolStats{
+		MaxOpenConnections: s.MaxOpenConnections,
+		OpenConnections:    s.OpenConnections,
+		InUse:              s.InUse,
+		Idle:               s.Idle,
+		WaitCount:          s.WaitCount,
+		WaitDurationMs:     s.WaitDuration.Milliseconds(),
+		MaxIdleClosed:      s.MaxIdleClosed,
+		MaxIdleTimeClosed:  s.MaxIdleTimeClosed,
+		MaxLifetimeClosed:  s.MaxLifetimeClosed,
+	}
+}
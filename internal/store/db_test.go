@@ -0,0 +1,210 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"maas/internal/config"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDataSourceName(t *testing.T) {
+	t.Run("Fields", func(t *testing.T) {
+		cfg := config.DatabaseConfig{
+			Host:           "db.internal",
+			Port:           5432,
+			User:           "maas",
+			Password:       `it's a \\secret`,
+			DBName:         "maasdb",
+			SSLMode:        "verify-full",
+			SSLRootCert:    "/etc/maas/ca.pem",
+			SSLCert:        "/etc/maas/client.pem",
+			SSLKey:         "/etc/maas/client.key",
+			ConnectTimeout: 5,
+		}
+
+		assert.Equal(t,
+			`host='db.internal' port=5432 user='maas' password='it\'s a \\\\secret' dbname='maasdb' sslmode='verify-full' `+
+				`sslrootcert='/etc/maas/ca.pem' sslcert='/etc/maas/client.pem' sslkey='/etc/maas/client.key' connect_timeout=5`,
+			DataSourceName(cfg))
+	})
+
+	t.Run("Optional Fields Omitted", func(t *testing.T) {
+		cfg := config.DatabaseConfig{Host: "localhost", Port: 5432, User: "maas", DBName: "maasdb", SSLMode: "disable"}
+
+		assert.Equal(t, `host='localhost' port=5432 user='maas' password='' dbname='maasdb' sslmode='disable'`, DataSourceName(cfg))
+	})
+
+	t.Run("DSN Replaces Fields", func(t *testing.T) {
+		cfg := config.DatabaseConfig{
+			DSN:  "postgres://maas:secret@db:5432/maasdb?sslmode=require",
+			Host: "ignored",
+		}
+
+		assert.Equal(t, cfg.DSN, DataSourceName(cfg))
+	})
+}
+
+// fakeClock is a clock that only moves when slept on.
+type fakeClock struct {
+	now    time.Time
+	sleeps []time.Duration
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Sleep(d time.Duration) {
+	c.sleeps = append(c.sleeps, d)
+	c.now = c.now.Add(d)
+}
+
+// fakePinger fails the first failures pings, with err or a refused
+// connection, and succeeds after that.
+type fakePinger struct {
+	failures int
+	err      error
+	pings    int
+}
+
+func (p *fakePinger) PingContext(ctx context.Context) error {
+	p.pings++
+	if p.pings <= p.failures {
+		if p.err != nil {
+			return p.err
+		}
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+// testLog collects the records logged by a connectRetry, one per line,
+// without timestamps.
+type testLog struct {
+	buf bytes.Buffer
+}
+
+func (l *testLog) lines() []string {
+	return strings.Split(strings.TrimSuffix(l.buf.String(), "\n"), "\n")
+}
+
+// newTestRetry returns a connectRetry on a fake clock, without jitter.
+func newTestRetry(timeout time.Duration) (connectRetry, *fakeClock, *testLog) {
+	clk := &fakeClock{now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+	logs := &testLog{}
+	return connectRetry{
+		timeout:      timeout,
+		initialDelay: time.Second,
+		maxDelay:     5 * time.Second,
+		clock:        clk,
+		jitter:       func(d time.Duration) time.Duration { return d },
+		logger: slog.New(slog.NewTextHandler(&logs.buf, &slog.HandlerOptions{
+			ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+				if a.Key == slog.TimeKey {
+					return slog.Attr{}
+				}
+				return a
+			},
+		})),
+	}, clk, logs
+}
+
+func TestConnectRetry(t *testing.T) {
+	t.Run("Connects First Time", func(t *testing.T) {
+		retry, clk, logs := newTestRetry(time.Minute)
+		db := &fakePinger{}
+
+		require.NoError(t, retry.ping(context.Background(), db))
+		assert.Equal(t, 1, db.pings)
+		assert.Empty(t, clk.sleeps)
+		assert.Empty(t, logs.buf.String())
+	})
+
+	t.Run("Backs Off Until Connected", func(t *testing.T) {
+		retry, clk, logs := newTestRetry(time.Minute)
+		db := &fakePinger{failures: 5}
+
+		require.NoError(t, retry.ping(context.Background(), db))
+		assert.Equal(t, 6, db.pings)
+		assert.Equal(t, []time.Duration{
+			1 * time.Second,
+			2 * time.Second,
+			4 * time.Second,
+			5 * time.Second, // Capped at maxDelay
+			5 * time.Second,
+		}, clk.sleeps)
+		lines := logs.lines()
+		require.Len(t, lines, 6)
+		assert.Equal(t, `level=WARN msg="Database unreachable; retrying" attempt=1 error="connection refused" retry_in=1s`, lines[0])
+		assert.Equal(t, `level=INFO msg="Connected to the database" attempts=6`, lines[5])
+	})
+
+	t.Run("Gives Up At Timeout", func(t *testing.T) {
+		retry, clk, _ := newTestRetry(10 * time.Second)
+		db := &fakePinger{failures: 100}
+
+		err := retry.ping(context.Background(), db)
+		assert.EqualError(t, err, "database unreachable after 5 attempts: connection refused")
+		// The last wait is cut short so the total never exceeds the timeout.
+		assert.Equal(t, []time.Duration{1 * time.Second, 2 * time.Second, 4 * time.Second, 3 * time.Second}, clk.sleeps)
+	})
+
+	t.Run("Zero Timeout Tries Once", func(t *testing.T) {
+		retry, clk, _ := newTestRetry(0)
+		db := &fakePinger{failures: 1}
+
+		assert.EqualError(t, retry.ping(context.Background(), db), "connection refused")
+		assert.Equal(t, 1, db.pings)
+		assert.Empty(t, clk.sleeps)
+	})
+
+	t.Run("Stops On Bad Credentials", func(t *testing.T) {
+		retry, clk, _ := newTestRetry(time.Minute)
+		db := &fakePinger{failures: 100, err: &pq.Error{Code: "28P01", Message: `password authentication failed for user "maas"`}}
+
+		err := retry.ping(context.Background(), db)
+		assert.EqualError(t, err, `pq: password authentication failed for user "maas"`)
+		assert.Equal(t, 1, db.pings)
+		assert.Empty(t, clk.sleeps)
+	})
+
+	t.Run("Stops On Missing Database", func(t *testing.T) {
+		retry, _, _ := newTestRetry(time.Minute)
+		db := &fakePinger{failures: 100, err: &pq.Error{Code: "3D000", Message: `database "maasdb" does not exist`}}
+
+		assert.Error(t, retry.ping(context.Background(), db))
+		assert.Equal(t, 1, db.pings)
+	})
+
+	t.Run("Retries While Database Starts", func(t *testing.T) {
+		retry, _, _ := newTestRetry(time.Minute)
+		db := &fakePinger{failures: 2, err: &pq.Error{Code: "57P03", Message: "the database system is starting up"}}
+
+		require.NoError(t, retry.ping(context.Background(), db))
+		assert.Equal(t, 3, db.pings)
+	})
+}
+
+func TestNewDBRejectsMalformedDSN(t *testing.T) {
+	// A DSN that cannot be parsed fails without waiting out the retry timeout
+	start := time.Now()
+	_, err := NewDB(config.DatabaseConfig{DSN: "host=db port", ConnectRetryTimeout: 60})
+
+	assert.ErrorContains(t, err, "invalid database connection settings")
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestEqualJitter(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		d := equalJitter(time.Second)
+		assert.GreaterOrEqual(t, d, 500*time.Millisecond)
+		assert.LessOrEqual(t, d, time.Second)
+	}
+}
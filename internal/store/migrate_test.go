@@ -0,0 +1,100 @@
+package store
+
+import (
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := LoadMigrations()
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+
+	for i, m := range migrations {
+		assert.Equal(t, i+1, m.Version, "migration versions should be consecutive")
+		assert.NotEmpty(t, m.Name)
+		assert.NotEmpty(t, m.Up)
+		assert.NotEmpty(t, m.Down)
+	}
+}
+
+func TestLoadMigrationsOrdersByVersion(t *testing.T) {
+	fsys := fstest.MapFS{
+		"m/0002_second.up.sql":   {Data: []byte("CREATE TABLE b ();")},
+		"m/0002_second.down.sql": {Data: []byte("DROP TABLE b;")},
+		"m/0001_first.up.sql":    {Data: []byte("CREATE TABLE a ();")},
+		"m/0001_first.down.sql":  {Data: []byte("DROP TABLE a;")},
+	}
+
+	migrations, err := loadMigrations(fsys, "m")
+	require.NoError(t, err)
+	require.Len(t, migrations, 2)
+	assert.Equal(t, Migration{Version: 1, Name: "first", Up: "CREATE TABLE a ();", Down: "DROP TABLE a;"}, migrations[0])
+	assert.Equal(t, 2, migrations[1].Version)
+}
+
+func TestLoadMigrationsRejectsInvalidFiles(t *testing.T) {
+	tests := map[string]fstest.MapFS{
+		"missing down step": {
+			"m/0001_first.up.sql": {Data: []byte("SELECT 1;")},
+		},
+		"bad version": {
+			"m/abc_first.up.sql":   {Data: []byte("SELECT 1;")},
+			"m/abc_first.down.sql": {Data: []byte("SELECT 1;")},
+		},
+		"unknown suffix": {
+			"m/0001_first.sql": {Data: []byte("SELECT 1;")},
+		},
+		"conflicting names": {
+			"m/0001_first.up.sql":   {Data: []byte("SELECT 1;")},
+			"m/0001_other.down.sql": {Data: []byte("SELECT 1;")},
+		},
+	}
+
+	for name, fsys := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := loadMigrations(fsys, "m")
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestMigratorCheck(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	migrator, err := NewMigrator(db)
+	require.NoError(t, err)
+
+	t.Run("Missing Table", func(t *testing.T) {
+		// Only reads are expected; the table is not created
+		mock.ExpectQuery("SELECT to_regclass").
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+		err := migrator.Check()
+
+		// Check every migration is reported pending
+		assert.ErrorIs(t, err, ErrSchemaBehind)
+		assert.Contains(t, err.Error(), "0001_")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Up To Date", func(t *testing.T) {
+		rows := sqlmock.NewRows([]string{"version", "applied_at"})
+		for v := 1; v <= migrator.Latest(); v++ {
+			rows.AddRow(v, time.Now())
+		}
+		mock.ExpectQuery("SELECT to_regclass").
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectQuery("SELECT version, applied_at FROM schema_migrations").WillReturnRows(rows)
+
+		assert.NoError(t, migrator.Check())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS api_calls;
+DROP TABLE IF EXISTS clients;
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS clients (
+    client_id SERIAL PRIMARY KEY,
+    auth_token TEXT UNIQUE NOT NULL,
+    token_balance INTEGER DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS api_calls (
+    call_id SERIAL PRIMARY KEY,
+    client_id INTEGER REFERENCES clients(client_id),
+    timestamp TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create an index on client_id in the api_calls table for faster lookups
+CREATE INDEX IF NOT EXISTS idx_api_calls_client_id ON api_calls (client_id);
@@ -0,0 +1,21 @@
+-- Append-only record of every change to a client's token balance
+CREATE TABLE IF NOT EXISTS token_ledger (
+    entry_id BIGSERIAL PRIMARY KEY,
+    client_id INTEGER NOT NULL REFERENCES clients(client_id),
+    kind TEXT NOT NULL CHECK (kind IN ('credit', 'debit', 'refund', 'adjustment')),
+    amount INTEGER NOT NULL,
+    balance_after INTEGER NOT NULL,
+    reason TEXT NOT NULL,
+    actor TEXT NOT NULL,
+    reference_id TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_token_ledger_client_id ON token_ledger (client_id, entry_id);
+
+-- Record opening balances so every balance is backed by the ledger
+INSERT INTO token_ledger (client_id, kind, amount, balance_after, reason, actor, reference_id)
+SELECT c.client_id, 'adjustment', c.token_balance, c.token_balance, 'opening balance', 'system', 'opening-balance'
+FROM clients c
+WHERE c.token_balance <> 0
+  AND NOT EXISTS (SELECT 1 FROM token_ledger l WHERE l.client_id = c.client_id);
@@ -0,0 +1,11 @@
+-- Responses remembered for POST /addtokens requests sent with an Idempotency-Key
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    client_id INTEGER NOT NULL REFERENCES clients(client_id),
+    idempotency_key TEXT NOT NULL,
+    request_hash TEXT NOT NULL,
+    status_code INTEGER NOT NULL,
+    response_body BYTEA NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (client_id, idempotency_key)
+);
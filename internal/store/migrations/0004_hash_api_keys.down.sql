@@ -0,0 +1,8 @@
+-- Hashed keys cannot be turned back into plaintext tokens, so clients that
+-- were rehashed are left without a usable token and must be issued a new one.
+ALTER TABLE clients DROP CONSTRAINT IF EXISTS clients_credentials_check;
+
+ALTER TABLE clients
+    DROP COLUMN IF EXISTS key_hash,
+    DROP COLUMN IF EXISTS key_salt,
+    DROP COLUMN IF EXISTS key_prefix;
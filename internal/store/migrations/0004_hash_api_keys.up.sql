@@ -0,0 +1,12 @@
+-- API keys are stored as a salted hash and looked up by their prefix. The
+-- plaintext auth_token column is kept only for clients that have not used
+-- their token since this migration; it is cleared when they are rehashed.
+ALTER TABLE clients ALTER COLUMN auth_token DROP NOT NULL;
+
+ALTER TABLE clients
+    ADD COLUMN key_prefix TEXT UNIQUE,
+    ADD COLUMN key_salt BYTEA,
+    ADD COLUMN key_hash BYTEA;
+
+ALTER TABLE clients
+    ADD CONSTRAINT clients_credentials_check CHECK (auth_token IS NOT NULL OR key_hash IS NOT NULL);
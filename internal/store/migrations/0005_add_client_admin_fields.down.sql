@@ -0,0 +1,4 @@
+ALTER TABLE clients
+    DROP COLUMN IF EXISTS disabled_at,
+    DROP COLUMN IF EXISTS created_at,
+    DROP COLUMN IF EXISTS name;
@@ -0,0 +1,4 @@
+ALTER TABLE clients
+    ADD COLUMN name TEXT NOT NULL DEFAULT '',
+    ADD COLUMN created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    ADD COLUMN disabled_at TIMESTAMP WITH TIME ZONE;
@@ -0,0 +1,12 @@
+-- Catalog of memes served by GET /v1/memes
+CREATE TABLE IF NOT EXISTS memes (
+    meme_id SERIAL PRIMARY KEY,
+    text TEXT NOT NULL,
+    image_url TEXT,
+    tags TEXT[] NOT NULL DEFAULT '{}',
+    language TEXT NOT NULL DEFAULT 'en',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    active BOOLEAN NOT NULL DEFAULT TRUE
+);
+
+CREATE INDEX IF NOT EXISTS idx_memes_active ON memes (meme_id) WHERE active;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_memes_search_vector;
+DROP TRIGGER IF EXISTS memes_search_vector_trigger ON memes;
+DROP FUNCTION IF EXISTS memes_search_vector_update();
+ALTER TABLE memes DROP COLUMN IF EXISTS search_vector;
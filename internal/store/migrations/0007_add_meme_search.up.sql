@@ -0,0 +1,21 @@
+-- Full-text search over meme text and tags. Text matches rank above tag
+-- matches. array_to_string is not immutable, so the vector is maintained by a
+-- trigger rather than a generated column.
+ALTER TABLE memes ADD COLUMN search_vector TSVECTOR;
+
+CREATE OR REPLACE FUNCTION memes_search_vector_update() RETURNS TRIGGER AS $$
+BEGIN
+    NEW.search_vector :=
+        setweight(to_tsvector('english', COALESCE(NEW.text, '')), 'A') ||
+        setweight(to_tsvector('english', array_to_string(NEW.tags, ' ')), 'B');
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER memes_search_vector_trigger
+    BEFORE INSERT OR UPDATE OF text, tags ON memes
+    FOR EACH ROW EXECUTE FUNCTION memes_search_vector_update();
+
+UPDATE memes SET text = text;
+
+CREATE INDEX IF NOT EXISTS idx_memes_search_vector ON memes USING GIN (search_vector);
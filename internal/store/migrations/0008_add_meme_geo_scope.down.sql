@@ -0,0 +1,12 @@
+DROP FUNCTION IF EXISTS meme_scope_rank(memes, DOUBLE PRECISION, DOUBLE PRECISION);
+DROP FUNCTION IF EXISTS haversine_km(DOUBLE PRECISION, DOUBLE PRECISION, DOUBLE PRECISION, DOUBLE PRECISION);
+
+ALTER TABLE memes DROP CONSTRAINT IF EXISTS memes_scope_check;
+
+ALTER TABLE memes
+    DROP COLUMN IF EXISTS region,
+    DROP COLUMN IF EXISTS radius_km,
+    DROP COLUMN IF EXISTS longitude,
+    DROP COLUMN IF EXISTS latitude;
+
+DROP TABLE IF EXISTS regions;
@@ -0,0 +1,57 @@
+-- Named regions memes can be scoped to, as latitude/longitude bounding boxes.
+-- A box crossing the antimeridian has min_longitude greater than
+-- max_longitude.
+CREATE TABLE IF NOT EXISTS regions (
+    name TEXT PRIMARY KEY,
+    min_latitude DOUBLE PRECISION NOT NULL CHECK (min_latitude BETWEEN -90 AND 90),
+    min_longitude DOUBLE PRECISION NOT NULL CHECK (min_longitude BETWEEN -180 AND 180),
+    max_latitude DOUBLE PRECISION NOT NULL CHECK (max_latitude BETWEEN -90 AND 90),
+    max_longitude DOUBLE PRECISION NOT NULL CHECK (max_longitude BETWEEN -180 AND 180),
+    CHECK (min_latitude <= max_latitude)
+);
+
+-- A meme is either global, scoped to a circle around a point, or scoped to a
+-- named region.
+ALTER TABLE memes
+    ADD COLUMN latitude DOUBLE PRECISION CHECK (latitude BETWEEN -90 AND 90),
+    ADD COLUMN longitude DOUBLE PRECISION CHECK (longitude BETWEEN -180 AND 180),
+    ADD COLUMN radius_km DOUBLE PRECISION CHECK (radius_km > 0),
+    ADD COLUMN region TEXT REFERENCES regions (name) ON UPDATE CASCADE;
+
+ALTER TABLE memes
+    ADD CONSTRAINT memes_scope_check CHECK (
+        (latitude IS NULL AND longitude IS NULL AND radius_km IS NULL) OR
+        (latitude IS NOT NULL AND longitude IS NOT NULL AND radius_km IS NOT NULL AND region IS NULL)
+    );
+
+-- Great-circle distance in kilometres between two points.
+CREATE OR REPLACE FUNCTION haversine_km(lat1 DOUBLE PRECISION, lon1 DOUBLE PRECISION, lat2 DOUBLE PRECISION, lon2 DOUBLE PRECISION)
+RETURNS DOUBLE PRECISION AS $$
+    SELECT 2 * 6371.0088 * asin(least(1, sqrt(
+        sin(radians(lat2 - lat1) / 2) ^ 2 +
+        cos(radians(lat1)) * cos(radians(lat2)) * sin(radians(lon2 - lon1) / 2) ^ 2
+    )))
+$$ LANGUAGE SQL IMMUTABLE STRICT;
+
+-- How well a meme's scope suits a caller at (lat, lon), lower being better:
+-- 0 when the scope contains the caller, 1 for global memes and 2 for memes
+-- scoped elsewhere or when the caller gave no location.
+CREATE OR REPLACE FUNCTION meme_scope_rank(m memes, lat DOUBLE PRECISION, lon DOUBLE PRECISION)
+RETURNS INTEGER AS $$
+    SELECT CASE
+        WHEN m.radius_km IS NULL AND m.region IS NULL THEN 1
+        WHEN lat IS NULL OR lon IS NULL THEN 2
+        WHEN m.radius_km IS NOT NULL THEN
+            CASE WHEN haversine_km(lat, lon, m.latitude, m.longitude) <= m.radius_km THEN 0 ELSE 2 END
+        WHEN EXISTS (
+            SELECT 1 FROM regions r
+            WHERE r.name = m.region
+              AND lat BETWEEN r.min_latitude AND r.max_latitude
+              AND CASE WHEN r.min_longitude <= r.max_longitude
+                       THEN lon BETWEEN r.min_longitude AND r.max_longitude
+                       ELSE lon >= r.min_longitude OR lon <= r.max_longitude
+                  END
+        ) THEN 0
+        ELSE 2
+    END
+$$ LANGUAGE SQL STABLE;
@@ -0,0 +1,3 @@
+ALTER TABLE clients
+    DROP COLUMN IF EXISTS rate_limit_burst,
+    DROP COLUMN IF EXISTS rate_limit_per_minute;
@@ -0,0 +1,4 @@
+-- NULL means the client is limited by the configured default.
+ALTER TABLE clients
+    ADD COLUMN rate_limit_per_minute INTEGER CHECK (rate_limit_per_minute > 0),
+    ADD COLUMN rate_limit_burst INTEGER CHECK (rate_limit_burst > 0);
@@ -1,12 +1,59 @@
 package store
 
-import "time"
+import (
+	"database/sql"
+	"time"
+)
 
-// Client represents a client in the database.
+// Client represents a client in the database. API keys are stored as a
+// salted hash looked up by prefix; AuthToken only holds a plaintext token
+// from before keys were hashed, until the client next uses it.
 type Client struct {
-	ClientID     int    `db:"client_id"`
-	AuthToken    string `db:"auth_token"`
-	TokenBalance int    `db:"token_balance"`
+	ClientID     int            `db:"client_id"`
+	AuthToken    sql.NullString `db:"auth_token"`
+	KeyPrefix    sql.NullString `db:"key_prefix"`
+	KeySalt      []byte         `db:"key_salt"`
+	KeyHash      []byte         `db:"key_hash"`
+	TokenBalance int            `db:"token_balance"`
+	Name         string         `db:"name"`
+	CreatedAt    time.Time      `db:"created_at"`
+	DisabledAt   sql.NullTime   `db:"disabled_at"`
+
+	// Per-client rate limit; NULL falls back to the configured default.
+	RateLimitPerMinute sql.NullInt32 `db:"rate_limit_per_minute"`
+	RateLimitBurst     sql.NullInt32 `db:"rate_limit_burst"`
+}
+
+// RateLimit is a client's own request rate limit. Zero fields mean the
+// configured default applies.
+type RateLimit struct {
+	ClientID          int
+	RequestsPerMinute int
+	Burst             int
+}
+
+// ClientSummary is the admin view of a client. It never includes key
+// material.
+type ClientSummary struct {
+	ClientID     int        `db:"client_id" json:"client_id"`
+	Name         string     `db:"name" json:"name"`
+	KeyPrefix    string     `db:"key_prefix" json:"key_prefix,omitempty"`
+	TokenBalance int        `db:"token_balance" json:"token_balance"`
+	CreatedAt    time.Time  `db:"created_at" json:"created_at"`
+	DisabledAt   *time.Time `db:"disabled_at" json:"disabled_at,omitempty"`
+}
+
+// ClientCredentials is returned when a client is created or its key is
+// rotated. APIKey is shown only this once.
+type ClientCredentials struct {
+	ClientSummary
+	APIKey string `json:"api_key"`
+}
+
+// ClientPage is one page of clients, ordered by ID.
+type ClientPage struct {
+	Clients    []ClientSummary `json:"clients"`
+	NextCursor int             `json:"next_cursor,omitempty"`
 }
 
 // APICall represents an API call made by a client.
@@ -16,10 +63,105 @@ type APICall struct {
 	Timestamp time.Time `db:"timestamp"`
 }
 
+// CallLogStats is a snapshot of the asynchronous API call log, for
+// monitoring.
+type CallLogStats struct {
+	Queued          int           // Calls waiting to be written
+	Capacity        int           // Calls the queue holds at most
+	Written         int64         // Calls written to the database
+	Failed          int64         // Calls lost because their batch could not be written
+	Dropped         int64         // Calls discarded because the queue was full or closed
+	Blocked         int64         // Times a request waited for room in the queue
+	BlockedDuration time.Duration // Total time requests waited
+}
+
+// Meme represents an entry in the meme catalog.
+type Meme struct {
+	MemeID    int             `db:"meme_id"`
+	Text      string          `db:"text"`
+	ImageURL  string          `db:"image_url"`
+	Tags      []string        `db:"tags"`
+	Language  string          `db:"language"`
+	CreatedAt time.Time       `db:"created_at"`
+	Active    bool            `db:"active"`
+	Latitude  sql.NullFloat64 `db:"latitude"` // Centre of a point scope
+	Longitude sql.NullFloat64 `db:"longitude"`
+	RadiusKM  sql.NullFloat64 `db:"radius_km"`
+	Region    sql.NullString  `db:"region"`     // Name of a region scope
+	ScopeRank int             `db:"scope_rank"` // Computed for the requesting caller
+}
+
+// Geographic scope ranks of a meme for a caller, best first.
+const (
+	ScopeLocal     = iota // The meme's scope contains the caller's location
+	ScopeGlobal           // The meme has no scope
+	ScopeElsewhere        // The meme is scoped elsewhere, or the caller gave no location
+)
+
 // MemeResponse represents the API response structure.
 type MemeResponse struct {
-	Meme      string `json:"meme"`
-	Latitude  string `json:"latitude,omitempty"`
-	Longitude string `json:"longitude,omitempty"`
-	Query     string `json:"query,omitempty"`
+	ID        int      `json:"id,omitempty"` // Zero for placeholder memes outside the catalog
+	Meme      string   `json:"meme"`
+	ImageURL  string   `json:"image_url,omitempty"`
+	Tags      []string `json:"tags,omitempty"`
+	Language  string   `json:"language,omitempty"`
+	Matched   bool     `json:"matched"` // Whether the meme matched the query, rather than being a random fallback
+	Local     bool     `json:"local"`   // Whether the meme is scoped to the caller's location
+	Latitude  string   `json:"latitude,omitempty"`
+	Longitude string   `json:"longitude,omitempty"`
+	Query     string   `json:"query,omitempty"`
+}
+
+// Ledger entry kinds.
+const (
+	LedgerCredit     = "credit"
+	LedgerDebit      = "debit"
+	LedgerRefund     = "refund"
+	LedgerAdjustment = "adjustment"
+)
+
+// LedgerMeta describes who made a balance change and why.
+type LedgerMeta struct {
+	Reason      string
+	Actor       string
+	ReferenceID string
+}
+
+// LedgerEntry represents a single row of a client's token ledger.
+type LedgerEntry struct {
+	EntryID      int64     `db:"entry_id" json:"entry_id"`
+	ClientID     int       `db:"client_id" json:"-"`
+	Kind         string    `db:"kind" json:"kind"`
+	Amount       int       `db:"amount" json:"amount"`
+	BalanceAfter int       `db:"balance_after" json:"balance_after"`
+	Reason       string    `db:"reason" json:"reason"`
+	Actor        string    `db:"actor" json:"actor"`
+	ReferenceID  string    `db:"reference_id" json:"reference_id"`
+	CreatedAt    time.Time `db:"created_at" json:"created_at"`
+}
+
+// LedgerPage is one page of ledger entries, newest first.
+type LedgerPage struct {
+	Entries    []LedgerEntry `json:"entries"`
+	NextCursor int64         `json:"next_cursor,omitempty"`
+}
+
+// Reconciliation compares a client's stored balance with the sum of its
+// ledger entries. A non-zero Drift means the balance was changed outside the
+// ledger.
+type Reconciliation struct {
+	ClientID      int `json:"client_id"`
+	TokenBalance  int `json:"token_balance"`
+	LedgerBalance int `json:"ledger_balance"`
+	Drift         int `json:"drift"` // TokenBalance minus LedgerBalance
+}
+
+// IdempotencyRecord is the stored outcome of a request made with an
+// Idempotency-Key, replayed when the same request is retried.
+type IdempotencyRecord struct {
+	Key          string `db:"idempotency_key"`
+	RequestHash  string `db:"request_hash"`
+	StatusCode   int    `db:"status_code"`
+	ResponseBody []byte `db:"response_body"`
+	Replayed     bool   `db:"-"`
 }
@@ -0,0 +1,170 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"math"
+	"net/http"
+
+	"maas/internal/config"
+	"maas/internal/store"
+
+	"github.com/gorilla/mux"
+)
+
+//go:generate mockgen -source=admin_handler.go -destination=mock/mock_client_service.go -package=mock_api
+
+// ClientService is the client management logic the admin handlers depend on.
+type ClientService interface {
+	CreateClient(ctx context.Context, name string, initialTokens int) (*store.ClientCredentials, error)
+	ListClients(ctx context.Context, cursor, limit int) (*store.ClientPage, error)
+	GetClient(ctx context.Context, clientID int) (*store.ClientSummary, error)
+	DisableClient(ctx context.Context, clientID int) (*store.ClientSummary, error)
+	EnableClient(ctx context.Context, clientID int) (*store.ClientSummary, error)
+	RotateKey(ctx context.Context, clientID int) (*store.ClientCredentials, error)
+	ReconcileClient(ctx context.Context, clientID int) (*store.Reconciliation, error)
+}
+
+// PoolStatter reports database connection pool statistics. *sql.DB
+// satisfies it.
+type PoolStatter interface {
+	Stats() sql.DBStats
+}
+
+// AdminHandler handles admin API requests for managing clients.
+type AdminHandler struct {
+	clientService ClientService
+	pool          PoolStatter
+	adminToken    string
+}
+
+// NewAdminHandler creates a new AdminHandler.
+func NewAdminHandler(clientService ClientService, pool PoolStatter, cfg config.AdminConfig) *AdminHandler {
+	return &AdminHandler{
+		clientService: clientService,
+		pool:          pool,
+		adminToken:    cfg.Token,
+	}
+}
+
+// AdminAuthMiddleware checks for the admin credential from the config.
+func (h *AdminHandler) AdminAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.adminToken == "" {
+			writeError(w, r, errAdminDisabled)
+			return
+		}
+
+		authToken := r.Header.Get("Authorization")
+		if authToken == "" {
+			writeError(w, r, errMissingToken)
+			return
+		}
+
+		if subtle.ConstantTimeCompare([]byte(authToken), []byte(h.adminToken)) != 1 {
+			writeError(w, r, errInvalidAdminKey)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// CreateClient handles the POST /admin/clients request.
+func (h *AdminHandler) CreateClient(w http.ResponseWriter, r *http.Request) {
+	req, err := decodeCreateClientRequest(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	creds, err := h.clientService.CreateClient(r.Context(), req.Name, req.InitialTokens)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(creds)
+}
+
+// ListClients handles the GET /admin/clients request.
+func (h *AdminHandler) ListClients(w http.ResponseWriter, r *http.Request) {
+	req, err := parsePageRequest(r.URL.Query(), math.MaxInt32)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	page, err := h.clientService.ListClients(r.Context(), int(req.Cursor), req.Limit)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// GetClient handles the GET /admin/clients/{id} request.
+func (h *AdminHandler) GetClient(w http.ResponseWriter, r *http.Request) {
+	h.withClientID(w, r, func(clientID int) (interface{}, error) {
+		return h.clientService.GetClient(r.Context(), clientID)
+	})
+}
+
+// DisableClient handles the POST /admin/clients/{id}/disable request.
+func (h *AdminHandler) DisableClient(w http.ResponseWriter, r *http.Request) {
+	h.withClientID(w, r, func(clientID int) (interface{}, error) {
+		return h.clientService.DisableClient(r.Context(), clientID)
+	})
+}
+
+// EnableClient handles the POST /admin/clients/{id}/enable request.
+func (h *AdminHandler) EnableClient(w http.ResponseWriter, r *http.Request) {
+	h.withClientID(w, r, func(clientID int) (interface{}, error) {
+		return h.clientService.EnableClient(r.Context(), clientID)
+	})
+}
+
+// RotateKey handles the POST /admin/clients/{id}/rotate-key request.
+func (h *AdminHandler) RotateKey(w http.ResponseWriter, r *http.Request) {
+	h.withClientID(w, r, func(clientID int) (interface{}, error) {
+		return h.clientService.RotateKey(r.Context(), clientID)
+	})
+}
+
+// ReconcileClient handles the GET /admin/clients/{id}/reconciliation request.
+func (h *AdminHandler) ReconcileClient(w http.ResponseWriter, r *http.Request) {
+	h.withClientID(w, r, func(clientID int) (interface{}, error) {
+		return h.clientService.ReconcileClient(r.Context(), clientID)
+	})
+}
+
+// GetPoolStats handles the GET /admin/db/stats request.
+func (h *AdminHandler) GetPoolStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(store.NewPoolStats(h.pool.Stats()))
+}
+
+// withClientID parses the {id} route variable, runs fn with it and writes
+// the result as JSON.
+func (h *AdminHandler) withClientID(w http.ResponseWriter, r *http.Request, fn func(clientID int) (interface{}, error)) {
+	clientID, err := parseClientID(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	result, err := fn(clientID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,361 @@
+package api_test
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"maas/internal/config"
+	"maas/internal/store"
+	"maas/pkg/api"
+	mock_api "maas/pkg/api/mock"
+	"maas/pkg/service"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+// newAdminRouter mounts the admin API, guarded by the "admin_token" credential.
+func newAdminRouter(clientService api.ClientService, pool api.PoolStatter) *mux.Router {
+	r := mux.NewRouter()
+	api.RegisterAdminRoutes(r, api.NewAdminHandler(clientService, pool, config.AdminConfig{Token: "admin_token"}))
+	return r
+}
+
+func TestAdminAuthMiddleware(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClientService := mock_api.NewMockClientService(ctrl)
+	r := newAdminRouter(mockClientService, nil)
+
+	t.Run("Missing Admin Token", func(t *testing.T) {
+		// Create a request without an Authorization header
+		req := httptest.NewRequest("GET", "/admin/clients", nil)
+		w := httptest.NewRecorder()
+
+		// Serve the request through the router
+		r.ServeHTTP(w, req)
+
+		// Check the response
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("Client Token Rejected", func(t *testing.T) {
+		// Create a request with a client token instead of the admin credential
+		req := httptest.NewRequest("GET", "/admin/clients", nil)
+		req.Header.Set("Authorization", "test_token")
+		w := httptest.NewRecorder()
+
+		// Serve the request through the router
+		r.ServeHTTP(w, req)
+
+		// Check the response
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("Admin API Disabled", func(t *testing.T) {
+		// Mount the admin API without a configured credential
+		disabled := mux.NewRouter()
+		api.RegisterAdminRoutes(disabled, api.NewAdminHandler(mockClientService, nil, config.AdminConfig{}))
+
+		// Create a request
+		req := httptest.NewRequest("GET", "/admin/clients", nil)
+		req.Header.Set("Authorization", "admin_token")
+		w := httptest.NewRecorder()
+
+		// Serve the request through the router
+		disabled.ServeHTTP(w, req)
+
+		// Check the response
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+}
+
+func TestCreateClientHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClientService := mock_api.NewMockClientService(ctrl)
+	r := newAdminRouter(mockClientService, nil)
+
+	t.Run("Successful Request", func(t *testing.T) {
+		// Set up expectations for the mock service
+		mockClientService.EXPECT().
+			CreateClient(gomock.Any(), "Acme", 100).
+			Return(&store.ClientCredentials{
+				ClientSummary: store.ClientSummary{ClientID: 7, Name: "Acme", TokenBalance: 100},
+				APIKey:        "maas_0123456789ab_secret",
+			}, nil)
+
+		// Create a request
+		req := httptest.NewRequest("POST", "/admin/clients", bytes.NewBufferString(`{"name": "Acme", "initial_tokens": 100}`))
+		req.Header.Set("Authorization", "admin_token")
+		w := httptest.NewRecorder()
+
+		// Serve the request through the router
+		r.ServeHTTP(w, req)
+
+		// Check the response
+		assert.Equal(t, http.StatusCreated, w.Code)
+		var response store.ClientCredentials
+		json.Unmarshal(w.Body.Bytes(), &response)
+		assert.Equal(t, 7, response.ClientID)
+		assert.Equal(t, "maas_0123456789ab_secret", response.APIKey)
+	})
+
+	t.Run("Missing Name", func(t *testing.T) {
+		// Create a request without a name
+		req := httptest.NewRequest("POST", "/admin/clients", bytes.NewBufferString(`{"initial_tokens": 100}`))
+		req.Header.Set("Authorization", "admin_token")
+		w := httptest.NewRecorder()
+
+		// Serve the request through the router
+		r.ServeHTTP(w, req)
+
+		// Check the response
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Every Invalid Field Listed", func(t *testing.T) {
+		// Create a request with two invalid fields
+		req := httptest.NewRequest("POST", "/admin/clients", bytes.NewBufferString(`{"name": "", "initial_tokens": -1}`))
+		req.Header.Set("Authorization", "admin_token")
+		w := httptest.NewRecorder()
+
+		// Serve the request through the router
+		r.ServeHTTP(w, req)
+
+		// Check the response
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, []api.FieldError{
+			{Field: "name", Message: "must be between 1 and 100 characters"},
+			{Field: "initial_tokens", Message: "must be between 0 and 2147483647"},
+		}, decodeErrorResponse(t, w).Details.Fields)
+	})
+}
+
+func TestListClientsHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClientService := mock_api.NewMockClientService(ctrl)
+	r := newAdminRouter(mockClientService, nil)
+
+	// Set up expectations for the mock service
+	mockClientService.EXPECT().
+		ListClients(gomock.Any(), 10, 2).
+		Return(&store.ClientPage{
+			Clients:    []store.ClientSummary{{ClientID: 11}, {ClientID: 12}},
+			NextCursor: 12,
+		}, nil)
+
+	// Create a request
+	req := httptest.NewRequest("GET", "/admin/clients?cursor=10&limit=2", nil)
+	req.Header.Set("Authorization", "admin_token")
+	w := httptest.NewRecorder()
+
+	// Serve the request through the router
+	r.ServeHTTP(w, req)
+
+	// Check the response
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response store.ClientPage
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Len(t, response.Clients, 2)
+	assert.Equal(t, 12, response.NextCursor)
+}
+
+func TestClientActionHandlers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClientService := mock_api.NewMockClientService(ctrl)
+	r := newAdminRouter(mockClientService, nil)
+
+	disabledAt := time.Now()
+
+	t.Run("Get Client", func(t *testing.T) {
+		// Set up expectations for the mock service
+		mockClientService.EXPECT().GetClient(gomock.Any(), 7).Return(&store.ClientSummary{ClientID: 7, Name: "Acme"}, nil)
+
+		// Create a request
+		req := httptest.NewRequest("GET", "/admin/clients/7", nil)
+		req.Header.Set("Authorization", "admin_token")
+		w := httptest.NewRecorder()
+
+		// Serve the request through the router
+		r.ServeHTTP(w, req)
+
+		// Check the response
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NotContains(t, w.Body.String(), "key_hash")
+	})
+
+	t.Run("Client Not Found", func(t *testing.T) {
+		// Set up expectations for the mock service
+		mockClientService.EXPECT().GetClient(gomock.Any(), 8).Return(nil, service.ErrClientNotFound)
+
+		// Create a request
+		req := httptest.NewRequest("GET", "/admin/clients/8", nil)
+		req.Header.Set("Authorization", "admin_token")
+		w := httptest.NewRecorder()
+
+		// Serve the request through the router
+		r.ServeHTTP(w, req)
+
+		// Check the response
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Disable Client", func(t *testing.T) {
+		// Set up expectations for the mock service
+		mockClientService.EXPECT().DisableClient(gomock.Any(), 7).Return(&store.ClientSummary{ClientID: 7, DisabledAt: &disabledAt}, nil)
+
+		// Create a request
+		req := httptest.NewRequest("POST", "/admin/clients/7/disable", nil)
+		req.Header.Set("Authorization", "admin_token")
+		w := httptest.NewRecorder()
+
+		// Serve the request through the router
+		r.ServeHTTP(w, req)
+
+		// Check the response
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "disabled_at")
+	})
+
+	t.Run("Enable Client", func(t *testing.T) {
+		// Set up expectations for the mock service
+		mockClientService.EXPECT().EnableClient(gomock.Any(), 7).Return(&store.ClientSummary{ClientID: 7}, nil)
+
+		// Create a request
+		req := httptest.NewRequest("POST", "/admin/clients/7/enable", nil)
+		req.Header.Set("Authorization", "admin_token")
+		w := httptest.NewRecorder()
+
+		// Serve the request through the router
+		r.ServeHTTP(w, req)
+
+		// Check the response
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NotContains(t, w.Body.String(), "disabled_at")
+	})
+
+	t.Run("Rotate Key", func(t *testing.T) {
+		// Set up expectations for the mock service
+		mockClientService.EXPECT().RotateKey(gomock.Any(), 7).Return(&store.ClientCredentials{
+			ClientSummary: store.ClientSummary{ClientID: 7},
+			APIKey:        "maas_ba9876543210_secret",
+		}, nil)
+
+		// Create a request
+		req := httptest.NewRequest("POST", "/admin/clients/7/rotate-key", nil)
+		req.Header.Set("Authorization", "admin_token")
+		w := httptest.NewRecorder()
+
+		// Serve the request through the router
+		r.ServeHTTP(w, req)
+
+		// Check the response
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "maas_ba9876543210_secret")
+	})
+
+	t.Run("Reconcile Client", func(t *testing.T) {
+		// Set up expectations for the mock service
+		mockClientService.EXPECT().ReconcileClient(gomock.Any(), 7).Return(&store.Reconciliation{
+			ClientID:      7,
+			TokenBalance:  105,
+			LedgerBalance: 100,
+			Drift:         5,
+		}, nil)
+
+		// Create a request
+		req := httptest.NewRequest("GET", "/admin/clients/7/reconciliation", nil)
+		req.Header.Set("Authorization", "admin_token")
+		w := httptest.NewRecorder()
+
+		// Serve the request through the router
+		r.ServeHTTP(w, req)
+
+		// Check the response
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"client_id": 7, "token_balance": 105, "ledger_balance": 100, "drift": 5}`, w.Body.String())
+	})
+
+	t.Run("Service Error", func(t *testing.T) {
+		// Set up expectations for the mock service to return an error
+		mockClientService.EXPECT().RotateKey(gomock.Any(), 7).Return(nil, errors.New("some error"))
+
+		// Create a request
+		req := httptest.NewRequest("POST", "/admin/clients/7/rotate-key", nil)
+		req.Header.Set("Authorization", "admin_token")
+		w := httptest.NewRecorder()
+
+		// Serve the request through the router
+		r.ServeHTTP(w, req)
+
+		// Check the response
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+	})
+
+	t.Run("Wrong Method", func(t *testing.T) {
+		// Create a request with the wrong method
+		req := httptest.NewRequest("GET", "/admin/clients/7/disable", nil)
+		req.Header.Set("Authorization", "admin_token")
+		w := httptest.NewRecorder()
+
+		// Serve the request through the router
+		r.ServeHTTP(w, req)
+
+		// Check the response
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+		assert.Equal(t, "POST", w.Header().Get("Allow"))
+	})
+}
+
+func TestGetPoolStatsHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPool := mock_api.NewMockPoolStatter(ctrl)
+	r := newAdminRouter(mock_api.NewMockClientService(ctrl), mockPool)
+
+	// Set up expectations for the mock pool
+	mockPool.EXPECT().Stats().Return(sql.DBStats{
+		MaxOpenConnections: 20,
+		OpenConnections:    3,
+		InUse:              2,
+		Idle:               1,
+		WaitCount:          4,
+		WaitDuration:       1500 * time.Millisecond,
+	})
+
+	// Create a request
+	req := httptest.NewRequest("GET", "/admin/db/stats", nil)
+	req.Header.Set("Authorization", "admin_token")
+	w := httptest.NewRecorder()
+
+	// Serve the request through the router
+	r.ServeHTTP(w, req)
+
+	// Check the response
+	assert.Equal(t, http.StatusOK, w.Code)
+	var stats store.PoolStats
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&stats))
+	assert.Equal(t, store.PoolStats{
+		MaxOpenConnections: 20,
+		OpenConnections:    3,
+		InUse:              2,
+		Idle:               1,
+		WaitCount:          4,
+		WaitDurationMs:     1500,
+	}, stats)
+}
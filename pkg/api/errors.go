@@ -0,0 +1,148 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"maas/internal/logging"
+	"maas/pkg/service"
+	"maas/utils"
+)
+
+// Errors raised by the API layer itself, mapped to responses alongside the
+// service errors.
+var (
+	errMissingToken     = errors.New("authorization token is required")
+	errInvalidAdminKey  = errors.New("invalid admin token")
+	errAdminDisabled    = errors.New("admin API is disabled")
+	errNotFound         = errors.New("not found")
+	errMethodNotAllowed = errors.New("method not allowed")
+	errRateLimited      = errors.New("rate limit exceeded")
+)
+
+// statusClientClosedRequest is the non-standard status recorded for requests
+// the client abandoned before a response was ready.
+const statusClientClosedRequest = 499
+
+// errorMapping describes the response for errors matching err.
+type errorMapping struct {
+	err     error
+	status  int
+	code    string
+	message string
+}
+
+// errorMappings lists the errors with a dedicated response. Codes are part
+// of the API contract and must not change once released.
+var errorMappings = []errorMapping{
+	{service.ErrInsufficientTokens, http.StatusPaymentRequired, "insufficient_tokens", "Insufficient token balance"},
+	{service.ErrInvalidAuthToken, http.StatusUnauthorized, "invalid_token", "Invalid authorization token"},
+	{service.ErrClientDisabled, http.StatusForbidden, "client_disabled", "Client is disabled"},
+	{service.ErrIdempotencyKeyReused, http.StatusUnprocessableEntity, "idempotency_key_reused", "Idempotency-Key was already used with a different request body"},
+	{service.ErrClientNotFound, http.StatusNotFound, "client_not_found", "Client not found"},
+	{errMissingToken, http.StatusUnauthorized, "missing_token", "Authorization token is required"},
+	{errInvalidAdminKey, http.StatusUnauthorized, "invalid_token", "Invalid authorization token"},
+	{errAdminDisabled, http.StatusForbidden, "admin_disabled", "Admin API is disabled"},
+	{errNotFound, http.StatusNotFound, "not_found", "Not found"},
+	{errMethodNotAllowed, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed"},
+	{errRateLimited, http.StatusTooManyRequests, "rate_limited", "Too many requests"},
+	{context.Canceled, statusClientClosedRequest, "request_cancelled", "Request cancelled"},
+	{context.DeadlineExceeded, http.StatusGatewayTimeout, "timeout", "Request timed out"},
+}
+
+// ErrorResponse is the body of every error response.
+type ErrorResponse struct {
+	Code      string      `json:"code"`
+	Message   string      `json:"message"`
+	RequestID string      `json:"request_id"`
+	Details   interface{} `json:"details,omitempty"`
+}
+
+// writeError writes the response for err. Validation errors list the
+// invalid fields in their details; errors without a mapping are reported as
+// internal errors without exposing their text. A request whose context has
+// ended is reported by the context's error, since drivers do not always wrap
+// it in the errors they return for abandoned queries.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	status, resp := http.StatusInternalServerError, ErrorResponse{
+		Code:    "internal_error",
+		Message: "Internal server error",
+	}
+
+	var verr *ValidationError
+	if errors.As(err, &verr) {
+		status = http.StatusBadRequest
+		resp.Code, resp.Message, resp.Details = "invalid_request", "Invalid request", verr
+	} else {
+		for _, m := range errorMappings {
+			if errors.Is(err, m.err) || errors.Is(r.Context().Err(), m.err) {
+				status, resp.Code, resp.Message = m.status, m.code, m.message
+				break
+			}
+		}
+	}
+	if resp.RequestID = requestID(r); resp.RequestID == "" {
+		resp.RequestID = utils.NewReferenceID()
+		w.Header().Set(requestIDHeader, resp.RequestID)
+	}
+
+	// Internal errors are hidden from the client, so they must be logged.
+	// A client hanging up is routine and not worth an error.
+	ctx := logging.WithRequestID(r.Context(), resp.RequestID)
+	switch {
+	case status == statusClientClosedRequest:
+		slog.InfoContext(ctx, "Request cancelled by client", "error", err)
+	case status >= http.StatusInternalServerError:
+		slog.ErrorContext(ctx, "Request failed", "error", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// requestIDHeader carries the ID that identifies a request in error
+// responses.
+const requestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds the X-Request-ID a client may choose.
+const maxRequestIDLength = 128
+
+// RequestIDMiddleware gives each request an ID, echoed in the X-Request-ID
+// response header. A well-formed ID sent by the client is kept so requests
+// can be traced across services.
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = utils.NewReferenceID()
+		}
+
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), id)))
+	})
+}
+
+// requestID returns the ID assigned to r by RequestIDMiddleware, or an empty
+// string when the middleware did not run.
+func requestID(r *http.Request) string {
+	return logging.RequestID(r.Context())
+}
+
+// validRequestID reports whether id is safe to echo back and log.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
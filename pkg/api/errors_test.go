@@ -0,0 +1,128 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"maas/internal/config"
+	"maas/pkg/api"
+	mock_api "maas/pkg/api/mock"
+	"maas/pkg/service"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// errorResponse is an error body with the details of a validation error.
+type errorResponse struct {
+	api.ErrorResponse
+	Details struct {
+		Fields []api.FieldError `json:"fields"`
+	} `json:"details"`
+}
+
+// decodeErrorResponse decodes the JSON error body of w.
+func decodeErrorResponse(t *testing.T, w *httptest.ResponseRecorder) errorResponse {
+	t.Helper()
+
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	var response errorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	return response
+}
+
+func TestErrorResponses(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMemeService := mock_api.NewMockMemeService(ctrl)
+	r := mux.NewRouter()
+	api.RegisterRoutes(r, api.NewMemeHandler(mockMemeService, nil, config.TokensConfig{MaxAmount: 1000}))
+
+	for _, tc := range []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{"Insufficient Tokens", service.ErrInsufficientTokens, http.StatusPaymentRequired, "insufficient_tokens"},
+		{"Invalid Token", service.ErrInvalidAuthToken, http.StatusUnauthorized, "invalid_token"},
+		{"Client Disabled", service.ErrClientDisabled, http.StatusForbidden, "client_disabled"},
+		{"Wrapped Error", fmt.Errorf("checking balance: %w", service.ErrInsufficientTokens), http.StatusPaymentRequired, "insufficient_tokens"},
+		{"Unexpected Error", fmt.Errorf("connection refused"), http.StatusInternalServerError, "internal_error"},
+		{"Request Cancelled", fmt.Errorf("querying client: %w", context.Canceled), 499, "request_cancelled"},
+		{"Deadline Exceeded", fmt.Errorf("querying client: %w", context.DeadlineExceeded), http.StatusGatewayTimeout, "timeout"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// Set up expectations for the mock service
+			mockMemeService.EXPECT().CheckTokenBalance(gomock.Any(), "test_token").Return(tc.err)
+
+			// Create a request
+			req := httptest.NewRequest("GET", "/v1/memes", nil)
+			req.Header.Set("Authorization", "test_token")
+			w := httptest.NewRecorder()
+
+			// Serve the request through the router
+			r.ServeHTTP(w, req)
+
+			// Check the response
+			assert.Equal(t, tc.status, w.Code)
+			response := decodeErrorResponse(t, w)
+			assert.Equal(t, tc.code, response.Code)
+			assert.NotEmpty(t, response.Message)
+			assert.NotContains(t, response.Message, "connection refused")
+			assert.Equal(t, w.Header().Get("X-Request-ID"), response.RequestID)
+			assert.NotEmpty(t, response.RequestID)
+		})
+	}
+
+	t.Run("Missing Token", func(t *testing.T) {
+		// Create a request without a token
+		req := httptest.NewRequest("GET", "/v1/balance", nil)
+		w := httptest.NewRecorder()
+
+		// Serve the request through the router
+		r.ServeHTTP(w, req)
+
+		// Check the response
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Equal(t, "missing_token", decodeErrorResponse(t, w).Code)
+	})
+
+	t.Run("Client Request ID Kept", func(t *testing.T) {
+		// Create a request carrying its own ID
+		req := httptest.NewRequest("GET", "/v1/unknown", nil)
+		req.Header.Set("X-Request-ID", "trace-1234")
+		w := httptest.NewRecorder()
+
+		// Serve the request through the router
+		r.ServeHTTP(w, req)
+
+		// Check the response
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, "trace-1234", w.Header().Get("X-Request-ID"))
+		response := decodeErrorResponse(t, w)
+		assert.Equal(t, "not_found", response.Code)
+		assert.Equal(t, "trace-1234", response.RequestID)
+	})
+
+	t.Run("Unsafe Request ID Replaced", func(t *testing.T) {
+		// Create a request with an ID that must not be echoed
+		req := httptest.NewRequest("GET", "/v1/unknown", nil)
+		req.Header.Set("X-Request-ID", "bad id\r\n")
+		w := httptest.NewRecorder()
+
+		// Serve the request through the router
+		r.ServeHTTP(w, req)
+
+		// Check the response
+		assert.NotEqual(t, "bad id\r\n", w.Header().Get("X-Request-ID"))
+		assert.NotEmpty(t, w.Header().Get("X-Request-ID"))
+	})
+}
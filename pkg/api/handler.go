@@ -1,46 +1,63 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"math"
 	"net/http"
 
+	"maas/internal/config"
+	"maas/internal/store"
 	"maas/pkg/service"
 )
 
+//go:generate mockgen -source=handler.go -destination=mock/mock_meme_service.go -package=mock_api
+
+// MemeService is the business logic the handlers depend on.
+type MemeService interface {
+	GetMeme(ctx context.Context, req service.MemeRequest, authToken string) (*store.MemeResponse, error)
+	Authenticate(ctx context.Context, authToken string) error
+	CheckTokenBalance(ctx context.Context, authToken string) error
+	AddTokens(ctx context.Context, authToken string, amount int) error
+	AddTokensIdempotent(ctx context.Context, authToken string, amount int, rec store.IdempotencyRecord) (*store.IdempotencyRecord, error)
+	GetTokenBalance(ctx context.Context, authToken string) (int, error)
+	GetRateLimit(ctx context.Context, authToken string) (*store.RateLimit, error)
+	GetLedger(ctx context.Context, authToken string, cursor int64, limit int) (*store.LedgerPage, error)
+}
+
 // MemeHandler handles API requests related to memes.
 type MemeHandler struct {
-	memeService *service.MemeService
+	memeService MemeService
+	limiter     RateLimiter
+	maxAmount   int
 }
 
-// NewMemeHandler creates a new MemeHandler.
-func NewMemeHandler(memeService *service.MemeService) *MemeHandler {
+// NewMemeHandler creates a new MemeHandler. Clients are not rate limited
+// when limiter is nil.
+func NewMemeHandler(memeService MemeService, limiter RateLimiter, cfg config.TokensConfig) *MemeHandler {
 	return &MemeHandler{
 		memeService: memeService,
+		limiter:     limiter,
+		maxAmount:   cfg.MaxAmount,
 	}
 }
 
 // GetMemes handles the GET /memes request.
 func (h *MemeHandler) GetMemes(w http.ResponseWriter, r *http.Request) {
-	// Extract query parameters (lat, lon, query)
-	latitude := r.URL.Query().Get("lat")
-	longitude := r.URL.Query().Get("lon")
-	query := r.URL.Query().Get("query")
+	// Validate the query parameters (lat, lon, query)
+	req, err := parseMemeRequest(r.URL.Query())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
 
 	// Get the auth token from the request header.
 	authToken := r.Header.Get("Authorization")
 
 	// Fetch the meme using the service layer.
-	meme, err := h.memeService.GetMeme(latitude, longitude, query, authToken)
+	meme, err := h.memeService.GetMeme(r.Context(), req, authToken)
 	if err != nil {
-		// Handle errors appropriately (e.g., insufficient tokens, invalid token)
-		switch err {
-		case service.ErrInsufficientTokens:
-			http.Error(w, "Insufficient token balance", http.StatusPaymentRequired)
-		case service.ErrInvalidAuthToken:
-			http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
-		default:
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
-		}
+		writeError(w, r, err)
 		return
 	}
 
@@ -53,39 +70,84 @@ func (h *MemeHandler) GetMemes(w http.ResponseWriter, r *http.Request) {
 func (h *MemeHandler) AddTokens(w http.ResponseWriter, r *http.Request) {
 	authToken := r.Header.Get("Authorization")
 	if authToken == "" {
-		http.Error(w, "Authorization token is required", http.StatusUnauthorized)
+		writeError(w, r, errMissingToken)
+		return
+	}
+
+	req, err := decodeAddTokensRequest(r, h.maxAmount)
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
 
-	var req service.AddTokensRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	idempotencyKey := r.Header.Get("Idempotency-Key")
+	if idempotencyKey == "" {
+		if err := h.memeService.AddTokens(r.Context(), authToken, req.Amount); err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Tokens added successfully"))
 		return
 	}
 
-	if err := h.memeService.AddTokens(authToken, req.Amount); err != nil {
-		http.Error(w, "Failed to add tokens", http.StatusInternalServerError)
+	// Remember the response alongside the credit so a retry replays it.
+	rec, err := h.memeService.AddTokensIdempotent(r.Context(), authToken, req.Amount, store.IdempotencyRecord{
+		Key:          idempotencyKey,
+		StatusCode:   http.StatusOK,
+		ResponseBody: []byte("Tokens added successfully"),
+	})
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Tokens added successfully"))
+	if rec.Replayed {
+		w.Header().Set("Idempotent-Replayed", "true")
+	}
+	w.WriteHeader(rec.StatusCode)
+	w.Write(rec.ResponseBody)
 }
 
 // GetBalance handles retrieving a client's token balance.
 func (h *MemeHandler) GetBalance(w http.ResponseWriter, r *http.Request) {
 	authToken := r.Header.Get("Authorization")
 	if authToken == "" {
-		http.Error(w, "Authorization token is required", http.StatusUnauthorized)
+		writeError(w, r, errMissingToken)
 		return
 	}
 
-	balance, err := h.memeService.GetTokenBalance(authToken)
+	balance, err := h.memeService.GetTokenBalance(r.Context(), authToken)
 	if err != nil {
-		http.Error(w, "Failed to get token balance", http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]int{"token_balance": balance})
 }
+
+// GetLedger handles paging through a client's token ledger.
+func (h *MemeHandler) GetLedger(w http.ResponseWriter, r *http.Request) {
+	authToken := r.Header.Get("Authorization")
+	if authToken == "" {
+		writeError(w, r, errMissingToken)
+		return
+	}
+
+	req, err := parsePageRequest(r.URL.Query(), math.MaxInt64)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	page, err := h.memeService.GetLedger(r.Context(), authToken, req.Cursor, req.Limit)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
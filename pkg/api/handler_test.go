@@ -2,26 +2,35 @@ package api_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"maas/internal/config"
+	"maas/internal/geo"
 	"maas/internal/store"
+	"maas/pkg/api"
+	mock_api "maas/pkg/api/mock"
+	"maas/pkg/repository"
 	"maas/pkg/service"
-	mock_service "maas/pkg/service/mock"
 
+	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestGetMemesHandler(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
-	mockMemeService := mock_service.NewMockMemeService(ctrl)
-	memeHandler := NewMemeHandler(mockMemeService)
+	mockMemeService := mock_api.NewMockMemeService(ctrl)
+	memeHandler := api.NewMemeHandler(mockMemeService, nil, config.TokensConfig{MaxAmount: 1000})
 
 	t.Run("Successful Request", func(t *testing.T) {
 		// Set up expectations for the mock service
@@ -29,11 +38,11 @@ func TestGetMemesHandler(t *testing.T) {
 			Meme: "Test meme",
 		}
 		mockMemeService.EXPECT().
-			GetMeme(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+			GetMeme(gomock.Any(), service.MemeRequest{Location: &geo.Point{Latitude: 40.7, Longitude: -73.9}, Query: "test"}, "test_token").
 			Return(expectedMeme, nil)
 
 		// Create a request
-		req := httptest.NewRequest("GET", "/memes?lat=123&lon=456&query=test", nil)
+		req := httptest.NewRequest("GET", "/memes?lat=40.7&lon=-73.9&query=test", nil)
 		req.Header.Set("Authorization", "test_token")
 		w := httptest.NewRecorder()
 
@@ -50,11 +59,11 @@ func TestGetMemesHandler(t *testing.T) {
 	t.Run("Insufficient Tokens", func(t *testing.T) {
 		// Set up expectations for the mock service
 		mockMemeService.EXPECT().
-			GetMeme(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+			GetMeme(gomock.Any(), gomock.Any(), gomock.Any()).
 			Return(nil, service.ErrInsufficientTokens)
 
 		// Create a request
-		req := httptest.NewRequest("GET", "/memes?lat=123&lon=456&query=test", nil)
+		req := httptest.NewRequest("GET", "/memes?lat=40.7&lon=-73.9&query=test", nil)
 		req.Header.Set("Authorization", "test_token")
 		w := httptest.NewRecorder()
 
@@ -68,11 +77,11 @@ func TestGetMemesHandler(t *testing.T) {
 	t.Run("Invalid Token", func(t *testing.T) {
 		// Set up expectations for the mock service
 		mockMemeService.EXPECT().
-			GetMeme(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+			GetMeme(gomock.Any(), gomock.Any(), gomock.Any()).
 			Return(nil, service.ErrInvalidAuthToken)
 
 		// Create a request
-		req := httptest.NewRequest("GET", "/memes?lat=123&lon=456&query=test", nil)
+		req := httptest.NewRequest("GET", "/memes?lat=40.7&lon=-73.9&query=test", nil)
 		req.Header.Set("Authorization", "test_token")
 		w := httptest.NewRecorder()
 
@@ -86,11 +95,11 @@ func TestGetMemesHandler(t *testing.T) {
 	t.Run("Internal Server Error", func(t *testing.T) {
 		// Set up expectations for the mock service
 		mockMemeService.EXPECT().
-			GetMeme(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+			GetMeme(gomock.Any(), gomock.Any(), gomock.Any()).
 			Return(nil, errors.New("some error"))
 
 		// Create a request
-		req := httptest.NewRequest("GET", "/memes?lat=123&lon=456&query=test", nil)
+		req := httptest.NewRequest("GET", "/memes?lat=40.7&lon=-73.9&query=test", nil)
 		req.Header.Set("Authorization", "test_token")
 		w := httptest.NewRecorder()
 
@@ -100,19 +109,57 @@ func TestGetMemesHandler(t *testing.T) {
 		// Check the response
 		assert.Equal(t, http.StatusInternalServerError, w.Code)
 	})
+
+	t.Run("Invalid Parameters", func(t *testing.T) {
+		// No service call is expected
+
+		// Create a request
+		req := httptest.NewRequest("GET", "/memes?lat=123&lon=west&query="+strings.Repeat("a", 201), nil)
+		req.Header.Set("Authorization", "test_token")
+		w := httptest.NewRecorder()
+
+		// Call the handler
+		memeHandler.GetMemes(w, req)
+
+		// Check the response lists every failing field
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		response := decodeErrorResponse(t, w)
+		assert.Equal(t, "invalid_request", response.Code)
+		assert.Equal(t, []api.FieldError{
+			{Field: "lat", Message: "must be between -90 and 90"},
+			{Field: "lon", Message: "must be a number"},
+			{Field: "query", Message: "must be at most 200 characters"},
+		}, response.Details.Fields)
+	})
+
+	t.Run("Missing Longitude", func(t *testing.T) {
+		// No service call is expected
+
+		// Create a request
+		req := httptest.NewRequest("GET", "/memes?lat=40.7", nil)
+		req.Header.Set("Authorization", "test_token")
+		w := httptest.NewRecorder()
+
+		// Call the handler
+		memeHandler.GetMemes(w, req)
+
+		// Check the response
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), `"field":"lon"`)
+	})
 }
 
 func TestAddTokensHandler(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
-	mockMemeService := mock_service.NewMockMemeService(ctrl)
-	memeHandler := NewMemeHandler(mockMemeService)
+	mockMemeService := mock_api.NewMockMemeService(ctrl)
+	memeHandler := api.NewMemeHandler(mockMemeService, nil, config.TokensConfig{MaxAmount: 1000})
 
 	t.Run("Successful Request", func(t *testing.T) {
 		// Set up expectations for the mock service
 		mockMemeService.EXPECT().
-			AddTokens("test_token", 100).
+			AddTokens(gomock.Any(), "test_token", 100).
 			Return(nil)
 
 		// Create a request body
@@ -160,10 +207,47 @@ func TestAddTokensHandler(t *testing.T) {
 		assert.Equal(t, http.StatusBadRequest, w.Code)
 	})
 
+	t.Run("Invalid Amount", func(t *testing.T) {
+		for body, message := range map[string]string{
+			`{"amount": 0}`:                    "must be between 1 and 1000",
+			`{"amount": -5}`:                   "must be between 1 and 1000",
+			`{"amount": 1001}`:                 "must be between 1 and 1000",
+			`{"amount": 99999999999999999999}`: "is out of range",
+			`{"amount": 1.5}`:                  "must be an integer",
+			`{"amount": "10"}`:                 "must be an integer",
+		} {
+			// Create a request with an invalid amount
+			req := httptest.NewRequest("POST", "/addtokens", bytes.NewBufferString(body))
+			req.Header.Set("Authorization", "test_token")
+			w := httptest.NewRecorder()
+
+			// Call the handler
+			memeHandler.AddTokens(w, req)
+
+			// Check the response
+			assert.Equal(t, http.StatusBadRequest, w.Code, body)
+			assert.Equal(t, []api.FieldError{{Field: "amount", Message: message}}, decodeErrorResponse(t, w).Details.Fields, body)
+		}
+	})
+
+	t.Run("Unknown Field", func(t *testing.T) {
+		// Create a request with a misspelled field
+		req := httptest.NewRequest("POST", "/addtokens", bytes.NewBufferString(`{"amount": 10, "ammount": 10}`))
+		req.Header.Set("Authorization", "test_token")
+		w := httptest.NewRecorder()
+
+		// Call the handler
+		memeHandler.AddTokens(w, req)
+
+		// Check the response
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), `{"field":"ammount","message":"is not a known field"}`)
+	})
+
 	t.Run("Service Error", func(t *testing.T) {
 		// Set up expectations for the mock service to return an error
 		mockMemeService.EXPECT().
-			AddTokens("test_token", 100).
+			AddTokens(gomock.Any(), "test_token", 100).
 			Return(errors.New("some error"))
 
 		// Create a request body
@@ -183,17 +267,73 @@ func TestAddTokensHandler(t *testing.T) {
 	})
 }
 
+func TestAddTokensIdempotencyHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMemeService := mock_api.NewMockMemeService(ctrl)
+	memeHandler := api.NewMemeHandler(mockMemeService, nil, config.TokensConfig{MaxAmount: 1000})
+
+	t.Run("Replayed Request", func(t *testing.T) {
+		// Set up expectations for the mock service to return a stored response
+		mockMemeService.EXPECT().
+			AddTokensIdempotent(gomock.Any(), "test_token", 100, gomock.Any()).
+			DoAndReturn(func(_ context.Context, authToken string, amount int, rec store.IdempotencyRecord) (*store.IdempotencyRecord, error) {
+				assert.Equal(t, "payment-1", rec.Key)
+				rec.Replayed = true
+				return &rec, nil
+			})
+
+		// Create a request with an Idempotency-Key header
+		body := map[string]int{"amount": 100}
+		jsonBody, _ := json.Marshal(body)
+		req := httptest.NewRequest("POST", "/addtokens", bytes.NewBuffer(jsonBody))
+		req.Header.Set("Authorization", "test_token")
+		req.Header.Set("Idempotency-Key", "payment-1")
+		w := httptest.NewRecorder()
+
+		// Call the handler
+		memeHandler.AddTokens(w, req)
+
+		// Check the response
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "true", w.Header().Get("Idempotent-Replayed"))
+		assert.Equal(t, "Tokens added successfully", w.Body.String())
+	})
+
+	t.Run("Key Reused With Different Body", func(t *testing.T) {
+		// Set up expectations for the mock service to reject the reused key
+		mockMemeService.EXPECT().
+			AddTokensIdempotent(gomock.Any(), "test_token", 100, gomock.Any()).
+			Return(nil, service.ErrIdempotencyKeyReused)
+
+		// Create a request with an Idempotency-Key header
+		body := map[string]int{"amount": 100}
+		jsonBody, _ := json.Marshal(body)
+		req := httptest.NewRequest("POST", "/addtokens", bytes.NewBuffer(jsonBody))
+		req.Header.Set("Authorization", "test_token")
+		req.Header.Set("Idempotency-Key", "payment-1")
+		w := httptest.NewRecorder()
+
+		// Call the handler
+		memeHandler.AddTokens(w, req)
+
+		// Check the response
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	})
+}
+
 func TestGetBalanceHandler(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
-	mockMemeService := mock_service.NewMockMemeService(ctrl)
-	memeHandler := NewMemeHandler(mockMemeService)
+	mockMemeService := mock_api.NewMockMemeService(ctrl)
+	memeHandler := api.NewMemeHandler(mockMemeService, nil, config.TokensConfig{MaxAmount: 1000})
 
 	t.Run("Successful Request", func(t *testing.T) {
 		// Set up expectations for the mock service
 		mockMemeService.EXPECT().
-			GetTokenBalance("test_token").
+			GetTokenBalance(gomock.Any(), "test_token").
 			Return(100, nil)
 
 		// Create a request
@@ -226,7 +366,7 @@ func TestGetBalanceHandler(t *testing.T) {
 	t.Run("Service Error", func(t *testing.T) {
 		// Set up expectations for the mock service to return an error
 		mockMemeService.EXPECT().
-			GetTokenBalance("test_token").
+			GetTokenBalance(gomock.Any(), "test_token").
 			Return(0, errors.New("some error"))
 
 		// Create a request
@@ -242,17 +382,81 @@ func TestGetBalanceHandler(t *testing.T) {
 	})
 }
 
+func TestGetLedgerHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMemeService := mock_api.NewMockMemeService(ctrl)
+	memeHandler := api.NewMemeHandler(mockMemeService, nil, config.TokensConfig{MaxAmount: 1000})
+
+	t.Run("Successful Request", func(t *testing.T) {
+		// Set up expectations for the mock service
+		mockMemeService.EXPECT().
+			GetLedger(gomock.Any(), "test_token", int64(42), 10).
+			Return(&store.LedgerPage{
+				Entries:    []store.LedgerEntry{{EntryID: 41, Kind: store.LedgerDebit, Amount: -1}},
+				NextCursor: 41,
+			}, nil)
+
+		// Create a request
+		req := httptest.NewRequest("GET", "/ledger?cursor=42&limit=10", nil)
+		req.Header.Set("Authorization", "test_token")
+		w := httptest.NewRecorder()
+
+		// Call the handler
+		memeHandler.GetLedger(w, req)
+
+		// Check the response
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response store.LedgerPage
+		json.Unmarshal(w.Body.Bytes(), &response)
+		assert.Equal(t, int64(41), response.NextCursor)
+		assert.Len(t, response.Entries, 1)
+	})
+
+	t.Run("Invalid Cursor", func(t *testing.T) {
+		// Create a request with a non-numeric cursor
+		req := httptest.NewRequest("GET", "/ledger?cursor=abc", nil)
+		req.Header.Set("Authorization", "test_token")
+		w := httptest.NewRecorder()
+
+		// Call the handler
+		memeHandler.GetLedger(w, req)
+
+		// Check the response
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Invalid Token", func(t *testing.T) {
+		// Set up expectations for the mock service to reject the token
+		mockMemeService.EXPECT().
+			GetLedger(gomock.Any(), "test_token", int64(0), 0).
+			Return(nil, service.ErrInvalidAuthToken)
+
+		// Create a request
+		req := httptest.NewRequest("GET", "/ledger", nil)
+		req.Header.Set("Authorization", "test_token")
+		w := httptest.NewRecorder()
+
+		// Call the handler
+		memeHandler.GetLedger(w, req)
+
+		// Check the response
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+}
+
 func TestAuthMiddleware(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
-	mockMemeService := mock_service.NewMockMemeService(ctrl)
-	memeHandler := NewMemeHandler(mockMemeService)
+	mockMemeService := mock_api.NewMockMemeService(ctrl)
+	memeHandler := api.NewMemeHandler(mockMemeService, nil, config.TokensConfig{MaxAmount: 1000})
 
 	t.Run("Successful Authentication", func(t *testing.T) {
 		// Set up expectations for the mock service
 		mockMemeService.EXPECT().
-			CheckTokenBalance("test_token").
+			CheckTokenBalance(gomock.Any(), "test_token").
 			Return(nil)
 
 		// Create a mock next handler that simulates a successful request
@@ -294,7 +498,7 @@ func TestAuthMiddleware(t *testing.T) {
 	t.Run("Insufficient Tokens", func(t *testing.T) {
 		// Set up expectations for the mock service to return ErrInsufficientTokens
 		mockMemeService.EXPECT().
-			CheckTokenBalance("test_token").
+			CheckTokenBalance(gomock.Any(), "test_token").
 			Return(service.ErrInsufficientTokens)
 
 		// Create a request with an Authorization header
@@ -315,10 +519,34 @@ func TestAuthMiddleware(t *testing.T) {
 		assert.Equal(t, http.StatusPaymentRequired, w.Code)
 	})
 
+	t.Run("Disabled Client", func(t *testing.T) {
+		// Set up expectations for the mock service to return ErrClientDisabled
+		mockMemeService.EXPECT().
+			CheckTokenBalance(gomock.Any(), "test_token").
+			Return(service.ErrClientDisabled)
+
+		// Create a request with an Authorization header
+		req := httptest.NewRequest("GET", "/some-protected-route", nil)
+		req.Header.Set("Authorization", "test_token")
+		w := httptest.NewRecorder()
+
+		// Create a mock next handler (should not be called)
+		nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Error("Next handler should not be called")
+		})
+
+		// Call the middleware
+		authMiddleware := memeHandler.AuthMiddleware(nextHandler)
+		authMiddleware.ServeHTTP(w, req)
+
+		// Check the response
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
 	t.Run("Service Error", func(t *testing.T) {
 		// Set up expectations for the mock service to return an error
 		mockMemeService.EXPECT().
-			CheckTokenBalance("test_token").
+			CheckTokenBalance(gomock.Any(), "test_token").
 			Return(errors.New("some error"))
 
 		// Create a request with an Authorization header
@@ -339,3 +567,34 @@ func TestAuthMiddleware(t *testing.T) {
 		assert.Equal(t, http.StatusInternalServerError, w.Code)
 	})
 }
+
+func TestGetMemesCancelledRequest(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	memeService := service.NewMemeService(repository.NewMemeRepository(db, nil, nil), config.TokensConfig{})
+	memeHandler := api.NewMemeHandler(memeService, nil, config.TokensConfig{})
+
+	// Set up a client lookup that takes far longer than the client will wait
+	mock.ExpectQuery("SELECT client_id, token_balance, key_salt, key_hash").
+		WillDelayFor(10 * time.Second).
+		WillReturnRows(sqlmock.NewRows([]string{"client_id"}))
+
+	// Create a request that the client abandons shortly after sending
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest("GET", "/v1/memes", nil).WithContext(ctx)
+	req.Header.Set("Authorization", "maas_0123456789ab_secret")
+	w := httptest.NewRecorder()
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	// Serve the request through the middleware and handler
+	start := time.Now()
+	memeHandler.AuthMiddleware(http.HandlerFunc(memeHandler.GetMemes)).ServeHTTP(w, req)
+
+	// Check the query was abandoned instead of running to completion, and
+	// reported as cancelled rather than as a server error
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.Equal(t, 499, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"request_cancelled"`)
+}
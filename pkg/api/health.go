@@ -0,0 +1,77 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+//go:generate mockgen -source=health.go -destination=mock/mock_pinger.go -package=mock_api
+
+// readyTimeout bounds the database ping made by the readiness check.
+const readyTimeout = 2 * time.Second
+
+// Pinger is the database check the readiness endpoint depends on.
+type Pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// HealthHandler serves the liveness and readiness endpoints.
+type HealthHandler struct {
+	db           Pinger
+	shuttingDown atomic.Bool
+}
+
+// NewHealthHandler creates a new HealthHandler.
+func NewHealthHandler(db Pinger) *HealthHandler {
+	return &HealthHandler{
+		db: db,
+	}
+}
+
+// ShuttingDown makes the readiness check fail from now on, so load balancers
+// stop sending traffic while in-flight requests drain.
+func (h *HealthHandler) ShuttingDown() {
+	h.shuttingDown.Store(true)
+}
+
+// healthStatus is the body of the health endpoints.
+type healthStatus struct {
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Healthz handles the GET /healthz request. It succeeds whenever the process
+// is able to serve HTTP.
+func (h *HealthHandler) Healthz(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, http.StatusOK, healthStatus{Status: "ok"})
+}
+
+// Readyz handles the GET /readyz request. It succeeds while the database is
+// reachable and the server is not shutting down.
+func (h *HealthHandler) Readyz(w http.ResponseWriter, r *http.Request) {
+	if h.shuttingDown.Load() {
+		writeHealth(w, http.StatusServiceUnavailable, healthStatus{Status: "unavailable", Reason: "shutting down"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+	defer cancel()
+	if err := h.db.PingContext(ctx); err != nil {
+		writeHealth(w, http.StatusServiceUnavailable, healthStatus{Status: "unavailable", Reason: "database unreachable"})
+		return
+	}
+
+	writeHealth(w, http.StatusOK, healthStatus{Status: "ready"})
+}
+
+// writeHealth writes a health check response. Health responses must never be
+// cached.
+func writeHealth(w http.ResponseWriter, status int, body healthStatus) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,103 @@
+package api_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"maas/pkg/api"
+	mock_api "maas/pkg/api/mock"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+// decodeHealth decodes the body of a health check response.
+func decodeHealth(t *testing.T, w *httptest.ResponseRecorder) map[string]string {
+	t.Helper()
+	var body map[string]string
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatalf("decoding health response: %v", err)
+	}
+	return body
+}
+
+func TestHealthHandlers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPinger := mock_api.NewMockPinger(ctrl)
+	health := api.NewHealthHandler(mockPinger)
+	r := mux.NewRouter()
+	api.RegisterHealthRoutes(r, health)
+
+	t.Run("Liveness", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/healthz", nil)
+		w := httptest.NewRecorder()
+
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+		assert.Equal(t, "ok", decodeHealth(t, w)["status"])
+	})
+
+	t.Run("Ready", func(t *testing.T) {
+		mockPinger.EXPECT().PingContext(gomock.Any()).Return(nil)
+
+		req := httptest.NewRequest("GET", "/readyz", nil)
+		w := httptest.NewRecorder()
+
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "ready", decodeHealth(t, w)["status"])
+	})
+
+	t.Run("Database Unreachable", func(t *testing.T) {
+		mockPinger.EXPECT().PingContext(gomock.Any()).Return(errors.New("connection refused"))
+
+		req := httptest.NewRequest("GET", "/readyz", nil)
+		w := httptest.NewRecorder()
+
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		body := decodeHealth(t, w)
+		assert.Equal(t, "unavailable", body["status"])
+		assert.Equal(t, "database unreachable", body["reason"])
+	})
+
+	t.Run("Shutting Down", func(t *testing.T) {
+		// The database is not consulted once shutdown has begun.
+		health.ShuttingDown()
+
+		req := httptest.NewRequest("GET", "/readyz", nil)
+		w := httptest.NewRecorder()
+
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Equal(t, "shutting down", decodeHealth(t, w)["reason"])
+
+		// Liveness is unaffected, so the process is not restarted mid-drain.
+		req = httptest.NewRequest("GET", "/healthz", nil)
+		w = httptest.NewRecorder()
+
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("Method Not Allowed", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/healthz", nil)
+		w := httptest.NewRecorder()
+
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	})
+}
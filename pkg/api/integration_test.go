@@ -0,0 +1,324 @@
+package api_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"maas/internal/apikey"
+	"maas/internal/config"
+	"maas/internal/store"
+	"maas/pkg/api"
+	"maas/pkg/repository"
+	"maas/pkg/service"
+
+	"github.com/gorilla/mux"
+	_ "github.com/lib/pq" // PostgreSQL driver
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testTokensConfig is the token configuration used by the database tests.
+var testTokensConfig = config.TokensConfig{IdempotencyTTL: 60, MaxAmount: 1000}
+
+// testMaxOpenConns caps the connections a test opens, well below the
+// default max_connections of 100.
+const testMaxOpenConns = 20
+
+// openTestDB connects to the database named by MAAS_TEST_DATABASE_DSN and
+// skips the test when it is not set.
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dsn := os.Getenv("MAAS_TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("MAAS_TEST_DATABASE_DSN not set; skipping database test")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	require.NoError(t, err)
+	// Concurrent tests queue for a connection rather than exceed the
+	// server's max_connections.
+	db.SetMaxOpenConns(testMaxOpenConns)
+	require.NoError(t, db.Ping())
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := store.NewMigrator(db)
+	require.NoError(t, err)
+	_, err = migrator.Up()
+	require.NoError(t, err)
+
+	return db
+}
+
+// createTestClient inserts a client with a freshly issued API key and the
+// given balance, removing it and its history when the test ends.
+func createTestClient(t *testing.T, db *sql.DB, balance int) (authToken string, clientID int) {
+	t.Helper()
+
+	key, err := apikey.Generate()
+	require.NoError(t, err)
+
+	err = db.QueryRow("INSERT INTO clients (key_prefix, key_salt, key_hash, token_balance) VALUES ($1, $2, $3, $4) RETURNING client_id",
+		key.Prefix, key.Salt, key.Hash, balance).Scan(&clientID)
+	require.NoError(t, err)
+	t.Cleanup(func() { deleteTestClient(db, clientID) })
+
+	return key.Token, clientID
+}
+
+// deleteTestClient removes a client and every row that references it.
+func deleteTestClient(db *sql.DB, clientID int) {
+	for _, table := range []string{"api_calls", "token_ledger", "idempotency_keys", "clients"} {
+		db.Exec("DELETE FROM "+table+" WHERE client_id = $1", clientID)
+	}
+}
+
+func TestGetMemesConcurrentTokenReservation(t *testing.T) {
+	db := openTestDB(t)
+
+	const (
+		balance  = 10
+		requests = 300
+	)
+
+	authToken, clientID := createTestClient(t, db, balance)
+
+	memeHandler := api.NewMemeHandler(service.NewMemeService(repository.NewMemeRepository(db, nil, nil), testTokensConfig), nil, testTokensConfig)
+	srv := httptest.NewServer(http.HandlerFunc(memeHandler.GetMemes))
+	defer srv.Close()
+
+	var succeeded, rejected int64
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+
+			req, _ := http.NewRequest("GET", srv.URL+"/memes", nil)
+			req.Header.Set("Authorization", authToken)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			resp.Body.Close()
+
+			switch resp.StatusCode {
+			case http.StatusOK:
+				atomic.AddInt64(&succeeded, 1)
+			case http.StatusPaymentRequired:
+				atomic.AddInt64(&rejected, 1)
+			default:
+				t.Errorf("unexpected status %d", resp.StatusCode)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	assert.Equal(t, int64(balance), succeeded)
+	assert.Equal(t, int64(requests-balance), rejected)
+
+	var remaining int
+	require.NoError(t, db.QueryRow("SELECT token_balance FROM clients WHERE client_id = $1", clientID).Scan(&remaining))
+	assert.Equal(t, 0, remaining)
+
+	var debits int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM token_ledger WHERE client_id = $1 AND kind = 'debit'", clientID).Scan(&debits))
+	assert.Equal(t, balance, debits)
+}
+
+func TestAddTokensIdempotencyKey(t *testing.T) {
+	db := openTestDB(t)
+
+	authToken, clientID := createTestClient(t, db, 0)
+
+	memeHandler := api.NewMemeHandler(service.NewMemeService(repository.NewMemeRepository(db, nil, nil), testTokensConfig), nil, testTokensConfig)
+
+	addTokens := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/addtokens", bytes.NewBufferString(body))
+		req.Header.Set("Authorization", authToken)
+		req.Header.Set("Idempotency-Key", key)
+		w := httptest.NewRecorder()
+		memeHandler.AddTokens(w, req)
+		return w
+	}
+
+	first := addTokens("payment-1", `{"amount": 25}`)
+	assert.Equal(t, http.StatusOK, first.Code)
+	assert.Empty(t, first.Header().Get("Idempotent-Replayed"))
+
+	retry := addTokens("payment-1", `{"amount":25}`)
+	assert.Equal(t, http.StatusOK, retry.Code)
+	assert.Equal(t, "true", retry.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, first.Body.String(), retry.Body.String())
+
+	mismatch := addTokens("payment-1", `{"amount": 50}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, mismatch.Code)
+
+	var balance int
+	require.NoError(t, db.QueryRow("SELECT token_balance FROM clients WHERE client_id = $1", clientID).Scan(&balance))
+	assert.Equal(t, 25, balance)
+}
+
+func TestLegacyTokenIsRehashedOnFirstUse(t *testing.T) {
+	db := openTestDB(t)
+
+	authToken := fmt.Sprintf("legacy_test_%d", time.Now().UnixNano())
+	var clientID int
+	err := db.QueryRow("INSERT INTO clients (auth_token, token_balance) VALUES ($1, 5) RETURNING client_id", authToken).Scan(&clientID)
+	require.NoError(t, err)
+	t.Cleanup(func() { deleteTestClient(db, clientID) })
+
+	memeHandler := api.NewMemeHandler(service.NewMemeService(repository.NewMemeRepository(db, nil, nil), testTokensConfig), nil, testTokensConfig)
+
+	getBalance := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/balance", nil)
+		req.Header.Set("Authorization", authToken)
+		w := httptest.NewRecorder()
+		memeHandler.GetBalance(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, getBalance().Code)
+
+	var plaintext sql.NullString
+	var keyHash []byte
+	require.NoError(t, db.QueryRow("SELECT auth_token, key_hash FROM clients WHERE client_id = $1", clientID).Scan(&plaintext, &keyHash))
+	assert.False(t, plaintext.Valid, "plaintext token should be cleared")
+	assert.NotEmpty(t, keyHash)
+
+	// The same token keeps working against the hashed key.
+	assert.Equal(t, http.StatusOK, getBalance().Code)
+}
+
+func TestDisabledClientIsForbidden(t *testing.T) {
+	db := openTestDB(t)
+
+	authToken, clientID := createTestClient(t, db, 5)
+	clientRepo := repository.NewClientRepository(db, nil)
+
+	r := mux.NewRouter()
+	api.RegisterRoutes(r, api.NewMemeHandler(service.NewMemeService(repository.NewMemeRepository(db, nil, nil), testTokensConfig), nil, testTokensConfig))
+
+	getBalance := func() int {
+		req := httptest.NewRequest("GET", "/v1/balance", nil)
+		req.Header.Set("Authorization", authToken)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	_, err := clientRepo.SetClientDisabled(context.Background(), clientID, true)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, getBalance())
+
+	_, err = clientRepo.SetClientDisabled(context.Background(), clientID, false)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, getBalance())
+}
+
+func TestGetMemesFullTextSearch(t *testing.T) {
+	db := openTestDB(t)
+
+	authToken, _ := createTestClient(t, db, 5)
+
+	word := fmt.Sprintf("zq%d", time.Now().UnixNano())
+	var memeID int
+	err := db.QueryRow("INSERT INTO memes (text, tags) VALUES ($1, $2) RETURNING meme_id",
+		"Nobody expects the "+word, "{testing}").Scan(&memeID)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Exec("DELETE FROM memes WHERE meme_id = $1", memeID) })
+
+	memeHandler := api.NewMemeHandler(service.NewMemeService(repository.NewMemeRepository(db, nil, nil), testTokensConfig), nil, testTokensConfig)
+
+	getMeme := func(query string) store.MemeResponse {
+		req := httptest.NewRequest("GET", "/v1/memes?query="+query, nil)
+		req.Header.Set("Authorization", authToken)
+		w := httptest.NewRecorder()
+		memeHandler.GetMemes(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var meme store.MemeResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &meme))
+		return meme
+	}
+
+	matched := getMeme(word)
+	assert.True(t, matched.Matched)
+	assert.Equal(t, memeID, matched.ID)
+
+	fallback := getMeme(word + "x")
+	assert.False(t, fallback.Matched)
+}
+
+func TestGetMemesGeoScope(t *testing.T) {
+	db := openTestDB(t)
+
+	authToken, _ := createTestClient(t, db, 5)
+
+	word := fmt.Sprintf("zq%d", time.Now().UnixNano())
+	region := "test-region-" + word
+	_, err := db.Exec("INSERT INTO regions (name, min_latitude, min_longitude, max_latitude, max_longitude) VALUES ($1, 40, 170, 50, -170)", region)
+	require.NoError(t, err)
+
+	var pointMemeID, regionMemeID int
+	err = db.QueryRow("INSERT INTO memes (text, latitude, longitude, radius_km) VALUES ($1, 40.7128, -74.0060, 50) RETURNING meme_id",
+		"Pizza rat strikes again "+word).Scan(&pointMemeID)
+	require.NoError(t, err)
+	err = db.QueryRow("INSERT INTO memes (text, region) VALUES ($1, $2) RETURNING meme_id",
+		"Date line crossing "+word, region).Scan(&regionMemeID)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		db.Exec("DELETE FROM memes WHERE meme_id IN ($1, $2)", pointMemeID, regionMemeID)
+		db.Exec("DELETE FROM regions WHERE name = $1", region)
+	})
+
+	memeHandler := api.NewMemeHandler(service.NewMemeService(repository.NewMemeRepository(db, nil, nil), testTokensConfig), nil, testTokensConfig)
+
+	getMeme := func(query string) (int, store.MemeResponse) {
+		req := httptest.NewRequest("GET", "/v1/memes?"+query, nil)
+		req.Header.Set("Authorization", authToken)
+		w := httptest.NewRecorder()
+		memeHandler.GetMemes(w, req)
+
+		var meme store.MemeResponse
+		if w.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &meme))
+		}
+		return w.Code, meme
+	}
+
+	// Brooklyn is within 50 km of the point scope.
+	code, meme := getMeme("query=" + word + "&lat=40.6782&lon=-73.9442")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, pointMemeID, meme.ID)
+	assert.True(t, meme.Local)
+
+	// The region wraps around the antimeridian.
+	code, meme = getMeme("query=" + word + "&lat=45&lon=179.5")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, regionMemeID, meme.ID)
+	assert.True(t, meme.Local)
+
+	// Far from both scopes, a match is still served but is not local.
+	code, meme = getMeme("query=" + word + "&lat=-33.8688&lon=151.2093")
+	require.Equal(t, http.StatusOK, code)
+	assert.True(t, meme.Matched)
+	assert.False(t, meme.Local)
+
+	code, _ = getMeme("query=" + word + "&lat=95&lon=0")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
@@ -0,0 +1,117 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"maas/internal/config"
+	"maas/internal/logging"
+	"maas/internal/store"
+	"maas/pkg/api"
+	mock_api "maas/pkg/api/mock"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// captureLogs sends the default logger's JSON records to the returned buffer
+// for the rest of the test.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	logger, err := logging.New(config.LogConfig{Level: "debug", Format: config.LogFormatJSON}, &buf)
+	require.NoError(t, err)
+
+	prev := slog.Default()
+	slog.SetDefault(logger)
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return &buf
+}
+
+// decodeLogs decodes one JSON record per line.
+func decodeLogs(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var records []map[string]interface{}
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		var record map[string]interface{}
+		require.NoError(t, dec.Decode(&record))
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestAccessLog(t *testing.T) {
+	logs := captureLogs(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMemeService := mock_api.NewMockMemeService(ctrl)
+	r := mux.NewRouter()
+	api.RegisterRoutes(r, api.NewMemeHandler(mockMemeService, nil, config.TokensConfig{MaxAmount: 1000}))
+
+	t.Run("Request Served", func(t *testing.T) {
+		logs.Reset()
+		mockMemeService.EXPECT().CheckTokenBalance(gomock.Any(), "maas_0123456789ab_secret").Return(nil)
+		mockMemeService.EXPECT().GetMeme(gomock.Any(), gomock.Any(), "maas_0123456789ab_secret").
+			Return(&store.MemeResponse{Meme: "Test meme"}, nil)
+
+		req := httptest.NewRequest("GET", "/v1/memes?query=cats", nil)
+		req.Header.Set("Authorization", "maas_0123456789ab_secret")
+		req.Header.Set("X-Request-ID", "req-42")
+		w := httptest.NewRecorder()
+
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, "req-42", w.Header().Get("X-Request-ID"))
+		records := decodeLogs(t, logs)
+		require.Len(t, records, 1)
+		assert.Equal(t, "Request served", records[0]["msg"])
+		assert.Equal(t, "GET", records[0]["method"])
+		assert.Equal(t, "/v1/memes", records[0]["route"])
+		assert.Equal(t, float64(http.StatusOK), records[0]["status"])
+		assert.Equal(t, "req-42", records[0]["request_id"])
+		assert.Contains(t, records[0], "latency_ms")
+		assert.NotContains(t, logs.String(), "secret")
+	})
+
+	t.Run("Internal Error Is Logged", func(t *testing.T) {
+		logs.Reset()
+		mockMemeService.EXPECT().Authenticate(gomock.Any(), "maas_0123456789ab_secret").Return(assert.AnError)
+
+		req := httptest.NewRequest("GET", "/v1/balance", nil)
+		req.Header.Set("Authorization", "maas_0123456789ab_secret")
+		w := httptest.NewRecorder()
+
+		r.ServeHTTP(w, req)
+
+		// Both lines carry the generated request ID returned to the client.
+		records := decodeLogs(t, logs)
+		require.Len(t, records, 2)
+		assert.Equal(t, "Request failed", records[0]["msg"])
+		assert.Equal(t, assert.AnError.Error(), records[0]["error"])
+		assert.Equal(t, float64(http.StatusInternalServerError), records[1]["status"])
+		for _, record := range records {
+			assert.Equal(t, w.Header().Get("X-Request-ID"), record["request_id"])
+		}
+		assert.NotContains(t, logs.String(), "secret")
+	})
+
+	t.Run("Unmatched Route", func(t *testing.T) {
+		logs.Reset()
+
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/nope", nil))
+
+		records := decodeLogs(t, logs)
+		require.Len(t, records, 1)
+		assert.Equal(t, "unmatched", records[0]["route"])
+		assert.Equal(t, float64(http.StatusNotFound), records[0]["status"])
+	})
+}
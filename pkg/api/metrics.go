@@ -0,0 +1,271 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"maas/internal/store"
+	"maas/pkg/service"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+//go:generate mockgen -source=metrics.go -destination=mock/mock_call_log_statter.go -package=mock_api
+
+// CallLogStatter reports statistics of the asynchronous API call log.
+// *repository.CallLogger implements it.
+type CallLogStatter interface {
+	Stats() store.CallLogStats
+}
+
+// metricsNamespace prefixes every metric the service exports.
+const metricsNamespace = "maas"
+
+// Metrics holds the Prometheus collectors for the API.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	tokensDeducted  prometheus.Counter
+	tokensAdded     prometheus.Counter
+	insufficient    prometheus.Counter
+}
+
+// NewMetrics creates the API metrics, along with gauges for the database
+// connection pool and, unless calls is nil, the API call log, in a registry
+// of their own.
+func NewMetrics(pool PoolStatter, calls CallLogStatter) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests served, by route, method and status.",
+		}, []string{"route", "method", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Time taken to serve HTTP requests, by route, method and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "status"}),
+		tokensDeducted: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "tokens_deducted_total",
+			Help:      "Tokens spent by clients on memes.",
+		}),
+		tokensAdded: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "tokens_added_total",
+			Help:      "Tokens added to client balances.",
+		}),
+		insufficient: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "insufficient_balance_rejections_total",
+			Help:      "Requests rejected because the client had no tokens left.",
+		}),
+	}
+
+	m.registry.MustRegister(
+		m.requests,
+		m.requestDuration,
+		m.tokensDeducted,
+		m.tokensAdded,
+		m.insufficient,
+		newPoolCollector(pool),
+	)
+	if calls != nil {
+		m.registry.MustRegister(newCallLogCollector(calls))
+	}
+	return m
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func (m *Metrics) Handler(w http.ResponseWriter, r *http.Request) {
+	promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
+
+// Middleware counts and times each request, labelled by its route template
+// rather than its path so that IDs in the path do not create new series.
+// Use it with mux.Router.Use, so that the route is known.
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		route := unmatchedRoute
+		if current := mux.CurrentRoute(r); current != nil {
+			if tmpl, err := current.GetPathTemplate(); err == nil {
+				route = tmpl
+			}
+		}
+		status := strconv.Itoa(rec.status)
+		m.requests.WithLabelValues(route, r.Method, status).Inc()
+		m.requestDuration.WithLabelValues(route, r.Method, status).Observe(time.Since(start).Seconds())
+	})
+}
+
+// statusRecorder remembers the status code written through it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// poolCollector exports database connection pool statistics.
+type poolCollector struct {
+	pool PoolStatter
+
+	maxOpen      *prometheus.Desc
+	open         *prometheus.Desc
+	inUse        *prometheus.Desc
+	idle         *prometheus.Desc
+	waitCount    *prometheus.Desc
+	waitDuration *prometheus.Desc
+}
+
+func newPoolCollector(pool PoolStatter) *poolCollector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, "db", name), help, nil, nil)
+	}
+	return &poolCollector{
+		pool:         pool,
+		maxOpen:      desc("max_open_connections", "Maximum number of open connections to the database; 0 means unlimited."),
+		open:         desc("open_connections", "Established connections to the database, in use or idle."),
+		inUse:        desc("in_use_connections", "Connections currently in use."),
+		idle:         desc("idle_connections", "Idle connections."),
+		waitCount:    desc("wait_count_total", "Times a caller waited for a connection."),
+		waitDuration: desc("wait_duration_seconds_total", "Time spent waiting for a connection."),
+	}
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.maxOpen
+	ch <- c.open
+	ch <- c.inUse
+	ch <- c.idle
+	ch <- c.waitCount
+	ch <- c.waitDuration
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.pool.Stats()
+	ch <- prometheus.MustNewConstMetric(c.maxOpen, prometheus.GaugeValue, float64(stats.MaxOpenConnections))
+	ch <- prometheus.MustNewConstMetric(c.open, prometheus.GaugeValue, float64(stats.OpenConnections))
+	ch <- prometheus.MustNewConstMetric(c.inUse, prometheus.GaugeValue, float64(stats.InUse))
+	ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(stats.Idle))
+	ch <- prometheus.MustNewConstMetric(c.waitCount, prometheus.CounterValue, float64(stats.WaitCount))
+	ch <- prometheus.MustNewConstMetric(c.waitDuration, prometheus.CounterValue, stats.WaitDuration.Seconds())
+}
+
+// callLogCollector exports statistics of the API call log, including how
+// often requests were held up or calls dropped because its queue was full.
+type callLogCollector struct {
+	calls CallLogStatter
+
+	queued          *prometheus.Desc
+	capacity        *prometheus.Desc
+	written         *prometheus.Desc
+	failed          *prometheus.Desc
+	dropped         *prometheus.Desc
+	blocked         *prometheus.Desc
+	blockedDuration *prometheus.Desc
+}
+
+func newCallLogCollector(calls CallLogStatter) *callLogCollector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, "call_log", name), help, nil, nil)
+	}
+	return &callLogCollector{
+		calls:           calls,
+		queued:          desc("queued_calls", "API calls waiting to be written."),
+		capacity:        desc("queue_capacity", "API calls the queue holds at most."),
+		written:         desc("written_total", "API calls written to the database."),
+		failed:          desc("failed_total", "API calls lost because their batch could not be written."),
+		dropped:         desc("dropped_total", "API calls discarded because the queue was full or closed."),
+		blocked:         desc("blocked_total", "Times a request waited for room in the queue."),
+		blockedDuration: desc("blocked_seconds_total", "Time requests spent waiting for room in the queue."),
+	}
+}
+
+func (c *callLogCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.queued
+	ch <- c.capacity
+	ch <- c.written
+	ch <- c.failed
+	ch <- c.dropped
+	ch <- c.blocked
+	ch <- c.blockedDuration
+}
+
+func (c *callLogCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.calls.Stats()
+	ch <- prometheus.MustNewConstMetric(c.queued, prometheus.GaugeValue, float64(stats.Queued))
+	ch <- prometheus.MustNewConstMetric(c.capacity, prometheus.GaugeValue, float64(stats.Capacity))
+	ch <- prometheus.MustNewConstMetric(c.written, prometheus.CounterValue, float64(stats.Written))
+	ch <- prometheus.MustNewConstMetric(c.failed, prometheus.CounterValue, float64(stats.Failed))
+	ch <- prometheus.MustNewConstMetric(c.dropped, prometheus.CounterValue, float64(stats.Dropped))
+	ch <- prometheus.MustNewConstMetric(c.blocked, prometheus.CounterValue, float64(stats.Blocked))
+	ch <- prometheus.MustNewConstMetric(c.blockedDuration, prometheus.CounterValue, stats.BlockedDuration.Seconds())
+}
+
+// instrumentedMemeService counts the tokens moved by a MemeService.
+type instrumentedMemeService struct {
+	MemeService
+	metrics *Metrics
+}
+
+// InstrumentMemeService wraps s so that tokens deducted and added, and
+// requests rejected for lack of tokens, are counted in m.
+func InstrumentMemeService(s MemeService, m *Metrics) MemeService {
+	return &instrumentedMemeService{MemeService: s, metrics: m}
+}
+
+func (s *instrumentedMemeService) GetMeme(ctx context.Context, req service.MemeRequest, authToken string) (*store.MemeResponse, error) {
+	meme, err := s.MemeService.GetMeme(ctx, req, authToken)
+	s.countRejection(err)
+	if err == nil {
+		s.metrics.tokensDeducted.Inc()
+	}
+	return meme, err
+}
+
+func (s *instrumentedMemeService) CheckTokenBalance(ctx context.Context, authToken string) error {
+	err := s.MemeService.CheckTokenBalance(ctx, authToken)
+	s.countRejection(err)
+	return err
+}
+
+func (s *instrumentedMemeService) AddTokens(ctx context.Context, authToken string, amount int) error {
+	err := s.MemeService.AddTokens(ctx, authToken, amount)
+	if err == nil {
+		s.metrics.tokensAdded.Add(float64(amount))
+	}
+	return err
+}
+
+func (s *instrumentedMemeService) AddTokensIdempotent(ctx context.Context, authToken string, amount int, rec store.IdempotencyRecord) (*store.IdempotencyRecord, error) {
+	result, err := s.MemeService.AddTokensIdempotent(ctx, authToken, amount, rec)
+	// A replayed request did not credit the tokens again.
+	if err == nil && !result.Replayed {
+		s.metrics.tokensAdded.Add(float64(amount))
+	}
+	return result, err
+}
+
+// countRejection counts err if it rejects a request for lack of tokens.
+func (s *instrumentedMemeService) countRejection(err error) {
+	if errors.Is(err, service.ErrInsufficientTokens) {
+		s.metrics.insufficient.Inc()
+	}
+}
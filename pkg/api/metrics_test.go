@@ -0,0 +1,127 @@
+package api_test
+
+import (
+	"bytes"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"maas/internal/config"
+	"maas/internal/store"
+	"maas/pkg/api"
+	mock_api "maas/pkg/api/mock"
+	"maas/pkg/service"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+// scrapeMetrics fetches the metrics endpoint and returns its body.
+func scrapeMetrics(t *testing.T, r http.Handler) string {
+	t.Helper()
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	return w.Body.String()
+}
+
+func TestMetrics(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMemeService := mock_api.NewMockMemeService(ctrl)
+	mockPool := mock_api.NewMockPoolStatter(ctrl)
+	mockPool.EXPECT().Stats().Return(sql.DBStats{
+		MaxOpenConnections: 20,
+		OpenConnections:    3,
+		InUse:              2,
+		Idle:               1,
+		WaitCount:          4,
+		WaitDuration:       1500 * time.Millisecond,
+	}).AnyTimes()
+	mockCalls := mock_api.NewMockCallLogStatter(ctrl)
+	mockCalls.EXPECT().Stats().Return(store.CallLogStats{
+		Queued:          3,
+		Capacity:        100,
+		Written:         40,
+		Dropped:         2,
+		Blocked:         5,
+		BlockedDuration: 250 * time.Millisecond,
+	}).AnyTimes()
+
+	metrics := api.NewMetrics(mockPool, mockCalls)
+	r := mux.NewRouter()
+	api.RegisterRoutes(r, api.NewMemeHandler(api.InstrumentMemeService(mockMemeService, metrics), nil, config.TokensConfig{MaxAmount: 1000}))
+	api.RegisterMetricsRoutes(r, metrics)
+
+	// A meme served, spending a token
+	mockMemeService.EXPECT().CheckTokenBalance(gomock.Any(), "test_token").Return(nil)
+	mockMemeService.EXPECT().GetMeme(gomock.Any(), gomock.Any(), "test_token").Return(&store.MemeResponse{Meme: "Test meme"}, nil)
+	req := httptest.NewRequest("GET", "/v1/memes", nil)
+	req.Header.Set("Authorization", "test_token")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	// A client with no tokens left
+	mockMemeService.EXPECT().CheckTokenBalance(gomock.Any(), "broke_token").Return(service.ErrInsufficientTokens)
+	req = httptest.NewRequest("GET", "/v1/memes", nil)
+	req.Header.Set("Authorization", "broke_token")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	// Tokens added, then the same request replayed
+	mockMemeService.EXPECT().Authenticate(gomock.Any(), "test_token").Return(nil).Times(2)
+	mockMemeService.EXPECT().AddTokensIdempotent(gomock.Any(), "test_token", 50, gomock.Any()).
+		Return(&store.IdempotencyRecord{StatusCode: http.StatusOK}, nil)
+	mockMemeService.EXPECT().AddTokensIdempotent(gomock.Any(), "test_token", 50, gomock.Any()).
+		Return(&store.IdempotencyRecord{StatusCode: http.StatusOK, Replayed: true}, nil)
+	for i := 0; i < 2; i++ {
+		req = httptest.NewRequest("POST", "/v1/tokens", bytes.NewBufferString(`{"amount": 50}`))
+		req.Header.Set("Authorization", "test_token")
+		req.Header.Set("Idempotency-Key", "key-1")
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	body := scrapeMetrics(t, r)
+
+	assert.Contains(t, body, `maas_http_requests_total{method="GET",route="/v1/memes",status="200"} 1`)
+	assert.Contains(t, body, `maas_http_requests_total{method="GET",route="/v1/memes",status="402"} 1`)
+	assert.Contains(t, body, `maas_http_requests_total{method="POST",route="/v1/tokens",status="200"} 2`)
+	assert.Contains(t, body, `maas_http_request_duration_seconds_count{method="GET",route="/v1/memes",status="200"} 1`)
+	assert.Contains(t, body, "maas_tokens_deducted_total 1\n")
+	assert.Contains(t, body, "maas_tokens_added_total 50\n")
+	assert.Contains(t, body, "maas_insufficient_balance_rejections_total 1\n")
+	assert.Contains(t, body, "maas_db_max_open_connections 20\n")
+	assert.Contains(t, body, "maas_db_in_use_connections 2\n")
+	assert.Contains(t, body, "maas_db_wait_duration_seconds_total 1.5\n")
+	assert.Contains(t, body, "maas_call_log_queued_calls 3\n")
+	assert.Contains(t, body, "maas_call_log_written_total 40\n")
+	assert.Contains(t, body, "maas_call_log_dropped_total 2\n")
+	assert.Contains(t, body, "maas_call_log_blocked_total 5\n")
+	assert.Contains(t, body, "maas_call_log_blocked_seconds_total 0.25\n")
+}
+
+func TestMetricsLabelRouteTemplate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClientService := mock_api.NewMockClientService(ctrl)
+	mockPool := mock_api.NewMockPoolStatter(ctrl)
+	mockPool.EXPECT().Stats().Return(sql.DBStats{}).AnyTimes()
+
+	metrics := api.NewMetrics(mockPool, nil)
+	r := newAdminRouter(mockClientService, mockPool)
+	api.RegisterMetricsRoutes(r, metrics)
+
+	mockClientService.EXPECT().GetClient(gomock.Any(), gomock.Any()).Return(&store.ClientSummary{}, nil).Times(2)
+	for _, path := range []string{"/admin/clients/7", "/admin/clients/8"} {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "admin_token")
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// Both requests share one series, keyed by the route template.
+	assert.Contains(t, scrapeMetrics(t, r), `maas_http_requests_total{method="GET",route="/admin/clients/{id:[0-9]+}",status="200"} 2`)
+}
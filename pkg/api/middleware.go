@@ -2,8 +2,6 @@ package api
 
 import (
 	"net/http"
-
-	"maas/pkg/service"
 )
 
 // AuthMiddleware checks for a valid auth token and sufficient token balance.
@@ -11,20 +9,48 @@ func (h *MemeHandler) AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authToken := r.Header.Get("Authorization")
 		if authToken == "" {
-			http.Error(w, "Authorization token is required", http.StatusUnauthorized)
+			writeError(w, r, errMissingToken)
 			return
 		}
 
-		err := h.memeService.CheckTokenBalance(authToken)
+		err := h.memeService.CheckTokenBalance(r.Context(), authToken)
 		if err != nil {
-			if err == service.ErrInsufficientTokens {
-				http.Error(w, "Insufficient token balance", http.StatusPaymentRequired)
-				return
-			}
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			writeError(w, r, err)
 			return
 		}
 
 		next.ServeHTTP(w, r)
 	})
 }
+
+// AuthenticateMiddleware checks for a valid auth token without requiring a
+// token balance, for routes that do not spend tokens.
+func (h *MemeHandler) AuthenticateMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authToken := r.Header.Get("Authorization")
+		if authToken == "" {
+			writeError(w, r, errMissingToken)
+			return
+		}
+
+		err := h.memeService.Authenticate(r.Context(), authToken)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// DeprecatedMiddleware marks responses from a legacy route as deprecated and
+// points clients at its replacement.
+func DeprecatedMiddleware(successor string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Deprecation", "true")
+			w.Header().Set("Link", "<"+successor+">; rel=\"successor-version\"")
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,49 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: metrics.go
+
+// Package mock_api is a generated GoMock package.
+package mock_api
+
+import (
+	store "maas/internal/store"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockCallLogStatter is a mock of CallLogStatter interface.
+type MockCallLogStatter struct {
+	ctrl     *gomock.Controller
+	recorder *MockCallLogStatterMockRecorder
+}
+
+// MockCallLogStatterMockRecorder is the mock recorder for MockCallLogStatter.
+type MockCallLogStatterMockRecorder struct {
+	mock *MockCallLogStatter
+}
+
+// NewMockCallLogStatter creates a new mock instance.
+func NewMockCallLogStatter(ctrl *gomock.Controller) *MockCallLogStatter {
+	mock := &MockCallLogStatter{ctrl: ctrl}
+	mock.recorder = &MockCallLogStatterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockCallLogStatter) EXPECT() *MockCallLogStatterMockRecorder {
+	return m.recorder
+}
+
+// Stats mocks base method.
+func (m *MockCallLogStatter) Stats() store.CallLogStats {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Stats")
+	ret0, _ := ret[0].(store.CallLogStats)
+	return ret0
+}
+
+// Stats indicates an expected call of Stats.
+func (mr *MockCallLogStatterMockRecorder) Stats() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stats", reflect.TypeOf((*MockCallLogStatter)(nil).Stats))
+}
@@ -0,0 +1,179 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: admin_handler.go
+
+// Package mock_api is a generated GoMock package.
+package mock_api
+
+import (
+	context "context"
+	sql "database/sql"
+	store "maas/internal/store"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockClientService is a mock of ClientService interface.
+type MockClientService struct {
+	ctrl     *gomock.Controller
+	recorder *MockClientServiceMockRecorder
+}
+
+// MockClientServiceMockRecorder is the mock recorder for MockClientService.
+type MockClientServiceMockRecorder struct {
+	mock *MockClientService
+}
+
+// NewMockClientService creates a new mock instance.
+func NewMockClientService(ctrl *gomock.Controller) *MockClientService {
+	mock := &MockClientService{ctrl: ctrl}
+	mock.recorder = &MockClientServiceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockClientService) EXPECT() *MockClientServiceMockRecorder {
+	return m.recorder
+}
+
+// CreateClient mocks base method.
+func (m *MockClientService) CreateClient(ctx context.Context, name string, initialTokens int) (*store.ClientCredentials, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateClient", ctx, name, initialTokens)
+	ret0, _ := ret[0].(*store.ClientCredentials)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateClient indicates an expected call of CreateClient.
+func (mr *MockClientServiceMockRecorder) CreateClient(ctx, name, initialTokens interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateClient", reflect.TypeOf((*MockClientService)(nil).CreateClient), ctx, name, initialTokens)
+}
+
+// DisableClient mocks base method.
+func (m *MockClientService) DisableClient(ctx context.Context, clientID int) (*store.ClientSummary, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DisableClient", ctx, clientID)
+	ret0, _ := ret[0].(*store.ClientSummary)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DisableClient indicates an expected call of DisableClient.
+func (mr *MockClientServiceMockRecorder) DisableClient(ctx, clientID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DisableClient", reflect.TypeOf((*MockClientService)(nil).DisableClient), ctx, clientID)
+}
+
+// EnableClient mocks base method.
+func (m *MockClientService) EnableClient(ctx context.Context, clientID int) (*store.ClientSummary, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EnableClient", ctx, clientID)
+	ret0, _ := ret[0].(*store.ClientSummary)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// EnableClient indicates an expected call of EnableClient.
+func (mr *MockClientServiceMockRecorder) EnableClient(ctx, clientID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnableClient", reflect.TypeOf((*MockClientService)(nil).EnableClient), ctx, clientID)
+}
+
+// GetClient mocks base method.
+func (m *MockClientService) GetClient(ctx context.Context, clientID int) (*store.ClientSummary, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetClient", ctx, clientID)
+	ret0, _ := ret[0].(*store.ClientSummary)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetClient indicates an expected call of GetClient.
+func (mr *MockClientServiceMockRecorder) GetClient(ctx, clientID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetClient", reflect.TypeOf((*MockClientService)(nil).GetClient), ctx, clientID)
+}
+
+// ListClients mocks base method.
+func (m *MockClientService) ListClients(ctx context.Context, cursor, limit int) (*store.ClientPage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListClients", ctx, cursor, limit)
+	ret0, _ := ret[0].(*store.ClientPage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListClients indicates an expected call of ListClients.
+func (mr *MockClientServiceMockRecorder) ListClients(ctx, cursor, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListClients", reflect.TypeOf((*MockClientService)(nil).ListClients), ctx, cursor, limit)
+}
+
+// ReconcileClient mocks base method.
+func (m *MockClientService) ReconcileClient(ctx context.Context, clientID int) (*store.Reconciliation, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReconcileClient", ctx, clientID)
+	ret0, _ := ret[0].(*store.Reconciliation)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReconcileClient indicates an expected call of ReconcileClient.
+func (mr *MockClientServiceMockRecorder) ReconcileClient(ctx, clientID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReconcileClient", reflect.TypeOf((*MockClientService)(nil).ReconcileClient), ctx, clientID)
+}
+
+// RotateKey mocks base method.
+func (m *MockClientService) RotateKey(ctx context.Context, clientID int) (*store.ClientCredentials, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RotateKey", ctx, clientID)
+	ret0, _ := ret[0].(*store.ClientCredentials)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RotateKey indicates an expected call of RotateKey.
+func (mr *MockClientServiceMockRecorder) RotateKey(ctx, clientID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RotateKey", reflect.TypeOf((*MockClientService)(nil).RotateKey), ctx, clientID)
+}
+
+// MockPoolStatter is a mock of PoolStatter interface.
+type MockPoolStatter struct {
+	ctrl     *gomock.Controller
+	recorder *MockPoolStatterMockRecorder
+}
+
+// MockPoolStatterMockRecorder is the mock recorder for MockPoolStatter.
+type MockPoolStatterMockRecorder struct {
+	mock *MockPoolStatter
+}
+
+// NewMockPoolStatter creates a new mock instance.
+func NewMockPoolStatter(ctrl *gomock.Controller) *MockPoolStatter {
+	mock := &MockPoolStatter{ctrl: ctrl}
+	mock.recorder = &MockPoolStatterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockPoolStatter) EXPECT() *MockPoolStatterMockRecorder {
+	return m.recorder
+}
+
+// Stats mocks base method.
+func (m *MockPoolStatter) Stats() sql.DBStats {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Stats")
+	ret0, _ := ret[0].(sql.DBStats)
+	return ret0
+}
+
+// Stats indicates an expected call of Stats.
+func (mr *MockPoolStatterMockRecorder) Stats() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stats", reflect.TypeOf((*MockPoolStatter)(nil).Stats))
+}
@@ -0,0 +1,154 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: handler.go
+
+// Package mock_api is a generated GoMock package.
+package mock_api
+
+import (
+	context "context"
+	store "maas/internal/store"
+	service "maas/pkg/service"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockMemeService is a mock of MemeService interface.
+type MockMemeService struct {
+	ctrl     *gomock.Controller
+	recorder *MockMemeServiceMockRecorder
+}
+
+// MockMemeServiceMockRecorder is the mock recorder for MockMemeService.
+type MockMemeServiceMockRecorder struct {
+	mock *MockMemeService
+}
+
+// NewMockMemeService creates a new mock instance.
+func NewMockMemeService(ctrl *gomock.Controller) *MockMemeService {
+	mock := &MockMemeService{ctrl: ctrl}
+	mock.recorder = &MockMemeServiceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockMemeService) EXPECT() *MockMemeServiceMockRecorder {
+	return m.recorder
+}
+
+// AddTokens mocks base method.
+func (m *MockMemeService) AddTokens(ctx context.Context, authToken string, amount int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddTokens", ctx, authToken, amount)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddTokens indicates an expected call of AddTokens.
+func (mr *MockMemeServiceMockRecorder) AddTokens(ctx, authToken, amount interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddTokens", reflect.TypeOf((*MockMemeService)(nil).AddTokens), ctx, authToken, amount)
+}
+
+// AddTokensIdempotent mocks base method.
+func (m *MockMemeService) AddTokensIdempotent(ctx context.Context, authToken string, amount int, rec store.IdempotencyRecord) (*store.IdempotencyRecord, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddTokensIdempotent", ctx, authToken, amount, rec)
+	ret0, _ := ret[0].(*store.IdempotencyRecord)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AddTokensIdempotent indicates an expected call of AddTokensIdempotent.
+func (mr *MockMemeServiceMockRecorder) AddTokensIdempotent(ctx, authToken, amount, rec interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddTokensIdempotent", reflect.TypeOf((*MockMemeService)(nil).AddTokensIdempotent), ctx, authToken, amount, rec)
+}
+
+// Authenticate mocks base method.
+func (m *MockMemeService) Authenticate(ctx context.Context, authToken string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Authenticate", ctx, authToken)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Authenticate indicates an expected call of Authenticate.
+func (mr *MockMemeServiceMockRecorder) Authenticate(ctx, authToken interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Authenticate", reflect.TypeOf((*MockMemeService)(nil).Authenticate), ctx, authToken)
+}
+
+// CheckTokenBalance mocks base method.
+func (m *MockMemeService) CheckTokenBalance(ctx context.Context, authToken string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CheckTokenBalance", ctx, authToken)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CheckTokenBalance indicates an expected call of CheckTokenBalance.
+func (mr *MockMemeServiceMockRecorder) CheckTokenBalance(ctx, authToken interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CheckTokenBalance", reflect.TypeOf((*MockMemeService)(nil).CheckTokenBalance), ctx, authToken)
+}
+
+// GetLedger mocks base method.
+func (m *MockMemeService) GetLedger(ctx context.Context, authToken string, cursor int64, limit int) (*store.LedgerPage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLedger", ctx, authToken, cursor, limit)
+	ret0, _ := ret[0].(*store.LedgerPage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetLedger indicates an expected call of GetLedger.
+func (mr *MockMemeServiceMockRecorder) GetLedger(ctx, authToken, cursor, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLedger", reflect.TypeOf((*MockMemeService)(nil).GetLedger), ctx, authToken, cursor, limit)
+}
+
+// GetMeme mocks base method.
+func (m *MockMemeService) GetMeme(ctx context.Context, req service.MemeRequest, authToken string) (*store.MemeResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetMeme", ctx, req, authToken)
+	ret0, _ := ret[0].(*store.MemeResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetMeme indicates an expected call of GetMeme.
+func (mr *MockMemeServiceMockRecorder) GetMeme(ctx, req, authToken interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMeme", reflect.TypeOf((*MockMemeService)(nil).GetMeme), ctx, req, authToken)
+}
+
+// GetRateLimit mocks base method.
+func (m *MockMemeService) GetRateLimit(ctx context.Context, authToken string) (*store.RateLimit, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRateLimit", ctx, authToken)
+	ret0, _ := ret[0].(*store.RateLimit)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRateLimit indicates an expected call of GetRateLimit.
+func (mr *MockMemeServiceMockRecorder) GetRateLimit(ctx, authToken interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRateLimit", reflect.TypeOf((*MockMemeService)(nil).GetRateLimit), ctx, authToken)
+}
+
+// GetTokenBalance mocks base method.
+func (m *MockMemeService) GetTokenBalance(ctx context.Context, authToken string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTokenBalance", ctx, authToken)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTokenBalance indicates an expected call of GetTokenBalance.
+func (mr *MockMemeServiceMockRecorder) GetTokenBalance(ctx, authToken interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTokenBalance", reflect.TypeOf((*MockMemeService)(nil).GetTokenBalance), ctx, authToken)
+}
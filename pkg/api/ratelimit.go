@@ -0,0 +1,63 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"maas/internal/ratelimit"
+)
+
+//go:generate mockgen -source=ratelimit.go -destination=mock/mock_rate_limiter.go -package=mock_api
+
+// RateLimiter decides whether a client may make another request.
+type RateLimiter interface {
+	Allow(key string, limit ratelimit.Limit) ratelimit.Decision
+}
+
+// RateLimitMiddleware limits how often each client may call the route. It
+// authenticates the client itself, so that it can run before middleware that
+// does more work, and answers clients over their limit with 429 Too Many
+// Requests. Every limited response carries the RateLimit-* headers.
+func (h *MemeHandler) RateLimitMiddleware(next http.Handler) http.Handler {
+	if h.limiter == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authToken := r.Header.Get("Authorization")
+		if authToken == "" {
+			writeError(w, r, errMissingToken)
+			return
+		}
+
+		limit, err := h.memeService.GetRateLimit(r.Context(), authToken)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		d := h.limiter.Allow(strconv.Itoa(limit.ClientID), ratelimit.Limit{
+			RequestsPerMinute: limit.RequestsPerMinute,
+			Burst:             limit.Burst,
+		})
+		if d.Limit > 0 {
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(d.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(d.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(d.Reset)))
+		}
+		if !d.Allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(max(ceilSeconds(d.RetryAfter), 1)))
+			writeError(w, r, errRateLimited)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ceilSeconds rounds d up to whole seconds, as the rate limit headers are
+// given in seconds.
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,132 @@
+package api_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"maas/internal/config"
+	"maas/internal/ratelimit"
+	"maas/internal/store"
+	"maas/pkg/api"
+	mock_api "maas/pkg/api/mock"
+	"maas/pkg/service"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimitMiddleware(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMemeService := mock_api.NewMockMemeService(ctrl)
+	mockLimiter := mock_api.NewMockRateLimiter(ctrl)
+	r := mux.NewRouter()
+	api.RegisterRoutes(r, api.NewMemeHandler(mockMemeService, mockLimiter, config.TokensConfig{MaxAmount: 1000}))
+
+	// getBalance serves GET /v1/balance for test_token.
+	getBalance := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/v1/balance", nil)
+		req.Header.Set("Authorization", "test_token")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Allowed", func(t *testing.T) {
+		// Set up expectations for the mocks
+		mockMemeService.EXPECT().GetRateLimit(gomock.Any(), "test_token").
+			Return(&store.RateLimit{ClientID: 7, RequestsPerMinute: 120, Burst: 20}, nil)
+		mockLimiter.EXPECT().Allow("7", ratelimit.Limit{RequestsPerMinute: 120, Burst: 20}).
+			Return(ratelimit.Decision{Allowed: true, Limit: 20, Remaining: 19, Reset: 500 * time.Millisecond})
+		mockMemeService.EXPECT().Authenticate(gomock.Any(), "test_token").Return(nil)
+		mockMemeService.EXPECT().GetTokenBalance(gomock.Any(), "test_token").Return(100, nil)
+
+		w := getBalance()
+
+		// Check the response
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "20", w.Header().Get("RateLimit-Limit"))
+		assert.Equal(t, "19", w.Header().Get("RateLimit-Remaining"))
+		assert.Equal(t, "1", w.Header().Get("RateLimit-Reset"))
+		assert.Empty(t, w.Header().Get("Retry-After"))
+	})
+
+	t.Run("Rejected", func(t *testing.T) {
+		// Set up expectations for the mocks; the request goes no further
+		mockMemeService.EXPECT().GetRateLimit(gomock.Any(), "test_token").
+			Return(&store.RateLimit{ClientID: 7}, nil)
+		mockLimiter.EXPECT().Allow("7", ratelimit.Limit{}).
+			Return(ratelimit.Decision{Limit: 10, Reset: 9500 * time.Millisecond, RetryAfter: 200 * time.Millisecond})
+
+		w := getBalance()
+
+		// Check the response
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Equal(t, "rate_limited", decodeErrorResponse(t, w).Code)
+		assert.Equal(t, "10", w.Header().Get("RateLimit-Limit"))
+		assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+		assert.Equal(t, "10", w.Header().Get("RateLimit-Reset"))
+		assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	})
+
+	t.Run("Unlimited", func(t *testing.T) {
+		// Set up expectations for the mocks
+		mockMemeService.EXPECT().GetRateLimit(gomock.Any(), "test_token").
+			Return(&store.RateLimit{ClientID: 7}, nil)
+		mockLimiter.EXPECT().Allow("7", ratelimit.Limit{}).Return(ratelimit.Decision{Allowed: true})
+		mockMemeService.EXPECT().Authenticate(gomock.Any(), "test_token").Return(nil)
+		mockMemeService.EXPECT().GetTokenBalance(gomock.Any(), "test_token").Return(100, nil)
+
+		w := getBalance()
+
+		// Check no limit is advertised
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("RateLimit-Limit"))
+	})
+
+	t.Run("Invalid Token", func(t *testing.T) {
+		// Set up expectations for the mocks; the limiter is not consulted
+		mockMemeService.EXPECT().GetRateLimit(gomock.Any(), "test_token").Return(nil, service.ErrInvalidAuthToken)
+
+		w := getBalance()
+
+		// Check the response
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Empty(t, w.Header().Get("RateLimit-Limit"))
+	})
+}
+
+func TestRateLimitMemory(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMemeService := mock_api.NewMockMemeService(ctrl)
+	limiter := ratelimit.NewMemory(config.RateLimitConfig{RequestsPerMinute: 1, Burst: 2})
+	r := mux.NewRouter()
+	api.RegisterRoutes(r, api.NewMemeHandler(mockMemeService, limiter, config.TokensConfig{MaxAmount: 1000}))
+
+	// Set up expectations for the mock service; only the burst gets through
+	mockMemeService.EXPECT().GetRateLimit(gomock.Any(), "test_token").
+		Return(&store.RateLimit{ClientID: 7}, nil).Times(3)
+	mockMemeService.EXPECT().CheckTokenBalance(gomock.Any(), "test_token").Return(nil).Times(2)
+	mockMemeService.EXPECT().GetMeme(gomock.Any(), gomock.Any(), "test_token").
+		Return(&store.MemeResponse{Meme: "Test meme"}, nil).Times(2)
+
+	var codes []int
+	var w *httptest.ResponseRecorder
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest("GET", "/v1/memes", nil)
+		req.Header.Set("Authorization", "test_token")
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		codes = append(codes, w.Code)
+	}
+
+	// Check the third request waits for the bucket to refill
+	assert.Equal(t, []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests}, codes)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+}
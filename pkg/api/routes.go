@@ -0,0 +1,173 @@
+package api
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// route describes a single endpoint of the API.
+type route struct {
+	method     string
+	path       string
+	legacyPath string // Deprecated unversioned alias, if any
+	handler    http.HandlerFunc
+	middleware []func(http.Handler) http.Handler
+}
+
+// routes returns the route table for the API.
+func (h *MemeHandler) routes() []route {
+	return []route{
+		{
+			method:     http.MethodGet,
+			path:       "/v1/memes",
+			legacyPath: "/memes",
+			handler:    h.GetMemes,
+			middleware: []func(http.Handler) http.Handler{h.RateLimitMiddleware, h.AuthMiddleware},
+		},
+		{
+			method:     http.MethodPost,
+			path:       "/v1/tokens",
+			legacyPath: "/addtokens",
+			handler:    h.AddTokens,
+			middleware: []func(http.Handler) http.Handler{h.RateLimitMiddleware, h.AuthenticateMiddleware},
+		},
+		{
+			method:     http.MethodGet,
+			path:       "/v1/balance",
+			legacyPath: "/balance",
+			handler:    h.GetBalance,
+			middleware: []func(http.Handler) http.Handler{h.RateLimitMiddleware, h.AuthenticateMiddleware},
+		},
+		{
+			method:     http.MethodGet,
+			path:       "/v1/ledger",
+			legacyPath: "/ledger",
+			handler:    h.GetLedger,
+			middleware: []func(http.Handler) http.Handler{h.RateLimitMiddleware, h.AuthenticateMiddleware},
+		},
+	}
+}
+
+// routes returns the route table for the admin API.
+func (h *AdminHandler) routes() []route {
+	auth := []func(http.Handler) http.Handler{h.AdminAuthMiddleware}
+	return []route{
+		{method: http.MethodPost, path: "/admin/clients", handler: h.CreateClient, middleware: auth},
+		{method: http.MethodGet, path: "/admin/clients", handler: h.ListClients, middleware: auth},
+		{method: http.MethodGet, path: "/admin/clients/{id:[0-9]+}", handler: h.GetClient, middleware: auth},
+		{method: http.MethodPost, path: "/admin/clients/{id:[0-9]+}/disable", handler: h.DisableClient, middleware: auth},
+		{method: http.MethodPost, path: "/admin/clients/{id:[0-9]+}/enable", handler: h.EnableClient, middleware: auth},
+		{method: http.MethodPost, path: "/admin/clients/{id:[0-9]+}/rotate-key", handler: h.RotateKey, middleware: auth},
+		{method: http.MethodGet, path: "/admin/clients/{id:[0-9]+}/reconciliation", handler: h.ReconcileClient, middleware: auth},
+		{method: http.MethodGet, path: "/admin/db/stats", handler: h.GetPoolStats, middleware: auth},
+	}
+}
+
+// routes returns the route table for the health endpoints. They are not
+// versioned and need no authentication.
+func (h *HealthHandler) routes() []route {
+	return []route{
+		{method: http.MethodGet, path: "/healthz", handler: h.Healthz},
+		{method: http.MethodGet, path: "/readyz", handler: h.Readyz},
+	}
+}
+
+// routes returns the route table for the metrics endpoint.
+func (m *Metrics) routes() []route {
+	return []route{
+		{method: http.MethodGet, path: "/metrics", handler: m.Handler},
+	}
+}
+
+// RegisterRoutes mounts the API on r. Each route is served under /v1, and
+// routes that predate versioning are also served at their old path with a
+// Deprecation header.
+func RegisterRoutes(r *mux.Router, h *MemeHandler) {
+	mount(r, h.routes())
+}
+
+// RegisterAdminRoutes mounts the admin API on r.
+func RegisterAdminRoutes(r *mux.Router, h *AdminHandler) {
+	mount(r, h.routes())
+}
+
+// RegisterHealthRoutes mounts the liveness and readiness endpoints on r.
+func RegisterHealthRoutes(r *mux.Router, h *HealthHandler) {
+	mount(r, h.routes())
+}
+
+// RegisterMetricsRoutes mounts the metrics endpoint on r and instruments
+// every route on r.
+func RegisterMetricsRoutes(r *mux.Router, m *Metrics) {
+	r.Use(m.Middleware)
+	mount(r, m.routes())
+}
+
+// mount registers routes on r. Every request, including those that match no
+// route, is given a request ID and logged.
+func mount(r *mux.Router, routes []route) {
+	for _, rt := range routes {
+		middleware := append([]func(http.Handler) http.Handler{RequestIDMiddleware, AccessLogMiddleware(rt.path)}, rt.middleware...)
+		r.Handle(rt.path, chain(rt.handler, middleware...)).Methods(rt.method)
+
+		if rt.legacyPath != "" {
+			middleware := append([]func(http.Handler) http.Handler{RequestIDMiddleware, AccessLogMiddleware(rt.legacyPath), DeprecatedMiddleware(rt.path)}, rt.middleware...)
+			r.Handle(rt.legacyPath, chain(rt.handler, middleware...)).Methods(rt.method)
+		}
+	}
+
+	unmatched := []func(http.Handler) http.Handler{RequestIDMiddleware, AccessLogMiddleware(unmatchedRoute)}
+	r.NotFoundHandler = chain(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		writeError(w, req, errNotFound)
+	}), unmatched...)
+	r.MethodNotAllowedHandler = chain(methodNotAllowedHandler(r), unmatched...)
+}
+
+// unmatchedRoute labels requests that match no route in logs and metrics.
+const unmatchedRoute = "unmatched"
+
+// chain wraps h in middleware, with the first middleware outermost.
+func chain(h http.Handler, middleware ...func(http.Handler) http.Handler) http.Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+	return h
+}
+
+// methodNotAllowedHandler answers requests for a known path with the wrong
+// method, listing the methods the path does accept.
+func methodNotAllowedHandler(router *mux.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen := make(map[string]bool)
+		router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+			pattern, err := route.GetPathRegexp()
+			if err != nil {
+				return nil
+			}
+			if matched, _ := regexp.MatchString(pattern, r.URL.Path); !matched {
+				return nil
+			}
+			methods, err := route.GetMethods()
+			if err != nil {
+				return nil
+			}
+			for _, m := range methods {
+				seen[m] = true
+			}
+			return nil
+		})
+
+		methods := make([]string, 0, len(seen))
+		for m := range seen {
+			methods = append(methods, m)
+		}
+		sort.Strings(methods)
+
+		w.Header().Set("Allow", strings.Join(methods, ", "))
+		writeError(w, r, errMethodNotAllowed)
+	})
+}
@@ -0,0 +1,107 @@
+package api_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"maas/internal/config"
+	"maas/internal/store"
+	"maas/pkg/api"
+	mock_api "maas/pkg/api/mock"
+	"maas/pkg/service"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegisterRoutes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMemeService := mock_api.NewMockMemeService(ctrl)
+	r := mux.NewRouter()
+	api.RegisterRoutes(r, api.NewMemeHandler(mockMemeService, nil, config.TokensConfig{MaxAmount: 1000}))
+
+	t.Run("Versioned Route", func(t *testing.T) {
+		// Set up expectations for the mock service
+		mockMemeService.EXPECT().CheckTokenBalance(gomock.Any(), "test_token").Return(nil)
+		mockMemeService.EXPECT().
+			GetMeme(gomock.Any(), gomock.Any(), "test_token").
+			Return(&store.MemeResponse{Meme: "Test meme"}, nil)
+
+		// Create a request
+		req := httptest.NewRequest("GET", "/v1/memes", nil)
+		req.Header.Set("Authorization", "test_token")
+		w := httptest.NewRecorder()
+
+		// Serve the request through the router
+		r.ServeHTTP(w, req)
+
+		// Check the response
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("Deprecation"))
+	})
+
+	t.Run("Legacy Route", func(t *testing.T) {
+		// Set up expectations for the mock service
+		mockMemeService.EXPECT().Authenticate(gomock.Any(), "test_token").Return(nil)
+		mockMemeService.EXPECT().GetTokenBalance(gomock.Any(), "test_token").Return(100, nil)
+
+		// Create a request
+		req := httptest.NewRequest("GET", "/balance", nil)
+		req.Header.Set("Authorization", "test_token")
+		w := httptest.NewRecorder()
+
+		// Serve the request through the router
+		r.ServeHTTP(w, req)
+
+		// Check the response
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "true", w.Header().Get("Deprecation"))
+		assert.Contains(t, w.Header().Get("Link"), "</v1/balance>")
+	})
+
+	t.Run("Auth Applied", func(t *testing.T) {
+		// Set up expectations for the mock service to reject the token
+		mockMemeService.EXPECT().Authenticate(gomock.Any(), "bad_token").Return(service.ErrInvalidAuthToken)
+
+		// Create a request
+		req := httptest.NewRequest("POST", "/v1/tokens", bytes.NewBufferString(`{"amount": 10}`))
+		req.Header.Set("Authorization", "bad_token")
+		w := httptest.NewRecorder()
+
+		// Serve the request through the router
+		r.ServeHTTP(w, req)
+
+		// Check the response
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("Method Not Allowed", func(t *testing.T) {
+		// Create a request with the wrong method
+		req := httptest.NewRequest("DELETE", "/v1/tokens", nil)
+		w := httptest.NewRecorder()
+
+		// Serve the request through the router
+		r.ServeHTTP(w, req)
+
+		// Check the response
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+		assert.Equal(t, "POST", w.Header().Get("Allow"))
+	})
+
+	t.Run("Not Found", func(t *testing.T) {
+		// Create a request for an unknown path
+		req := httptest.NewRequest("GET", "/v1/unknown", nil)
+		w := httptest.NewRecorder()
+
+		// Serve the request through the router
+		r.ServeHTTP(w, req)
+
+		// Check the response
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
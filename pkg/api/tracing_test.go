@@ -0,0 +1,180 @@
+package api_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"maas/internal/apikey"
+	"maas/internal/config"
+	"maas/pkg/api"
+	"maas/pkg/repository"
+	"maas/pkg/service"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordSpans installs a tracer provider that keeps finished spans in memory
+// for the rest of the test.
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	})
+	return recorder
+}
+
+func TestTracing(t *testing.T) {
+	recorder := recordSpans(t)
+
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	memeService := service.NewMemeService(repository.NewMemeRepository(db, nil, nil), config.TokensConfig{})
+	r := mux.NewRouter()
+	r.Use(api.TracingMiddleware)
+	api.RegisterRoutes(r, api.NewMemeHandler(memeService, nil, config.TokensConfig{}))
+
+	// Set up a client lookup that fails
+	mock.ExpectQuery("SELECT client_id, token_balance, key_salt, key_hash").
+		WillReturnError(errors.New("connection reset"))
+
+	// Create a request that continues a caller's trace
+	req := httptest.NewRequest("GET", "/v1/balance", nil)
+	req.Header.Set("Authorization", "maas_0123456789ab_secret")
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+
+	// Serve the request through the router
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	// Check the spans, which end innermost first
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+	repoSpan, serviceSpan, serverSpan := spans[0], spans[1], spans[2]
+
+	assert.Equal(t, "GET /v1/balance", serverSpan.Name())
+	assert.Equal(t, trace.SpanKindServer, serverSpan.SpanKind())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", serverSpan.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", serverSpan.Parent().SpanID().String())
+	assert.True(t, serverSpan.Parent().IsRemote())
+	assert.Equal(t, codes.Error, serverSpan.Status().Code)
+
+	assert.Equal(t, "MemeService.Authenticate", serviceSpan.Name())
+	assert.Equal(t, serverSpan.SpanContext().SpanID(), serviceSpan.Parent().SpanID())
+	assert.Equal(t, codes.Error, serviceSpan.Status().Code)
+
+	assert.Equal(t, "MemeRepository.GetTokenBalance", repoSpan.Name())
+	assert.Equal(t, trace.SpanKindClient, repoSpan.SpanKind())
+	assert.Equal(t, serviceSpan.SpanContext().SpanID(), repoSpan.Parent().SpanID())
+	assert.Equal(t, "connection reset", repoSpan.Status().Description)
+
+	// The token is never recorded
+	for _, span := range spans {
+		for _, attr := range span.Attributes() {
+			assert.NotContains(t, attr.Value.Emit(), "secret")
+		}
+	}
+}
+
+func TestTracingMemeRequest(t *testing.T) {
+	recorder := recordSpans(t)
+
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	memeService := service.NewMemeService(repository.NewMemeRepository(db, nil, nil), config.TokensConfig{})
+	r := mux.NewRouter()
+	r.Use(api.TracingMiddleware)
+	api.RegisterRoutes(r, api.NewMemeHandler(memeService, nil, config.TokensConfig{}))
+	key, err := apikey.Generate()
+	require.NoError(t, err)
+
+	// Set up the queries of a served meme: the balance check, the token
+	// reservation, a search with no matches, the catalog fallback and a call
+	// log write that fails without failing the request
+	clientRows := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"client_id", "token_balance", "key_salt", "key_hash", "disabled", "rate_limit_per_minute", "rate_limit_burst"}).
+			AddRow(7, 100, key.Salt, key.Hash, false, 0, 0)
+	}
+	mock.ExpectQuery("SELECT client_id, token_balance, key_salt, key_hash").WillReturnRows(clientRows())
+	mock.ExpectQuery("SELECT client_id, token_balance, key_salt, key_hash").WillReturnRows(clientRows())
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT token_balance FROM clients").
+		WillReturnRows(sqlmock.NewRows([]string{"token_balance"}).AddRow(100))
+	mock.ExpectQuery("UPDATE clients SET token_balance").
+		WillReturnRows(sqlmock.NewRows([]string{"token_balance"}).AddRow(99))
+	mock.ExpectExec("INSERT INTO token_ledger").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	memeColumns := []string{"meme_id", "text", "image_url", "tags", "language", "created_at", "active", "latitude", "longitude", "radius_km", "region", "scope_rank"}
+	mock.ExpectQuery("FROM memes, websearch_to_tsquery").WillReturnRows(sqlmock.NewRows(memeColumns))
+	mock.ExpectQuery("FROM memes").
+		WillReturnRows(sqlmock.NewRows(memeColumns).
+			AddRow(3, "One does not simply", "", "{classic}", "en", time.Now(), true, nil, nil, nil, nil, 2))
+	mock.ExpectQuery("SELECT client_id, token_balance, key_salt, key_hash").WillReturnRows(clientRows())
+	mock.ExpectExec("INSERT INTO api_calls").WillReturnError(errors.New("disk full"))
+
+	// Create a request
+	req := httptest.NewRequest("GET", "/v1/memes?query=cats", nil)
+	req.Header.Set("Authorization", key.Token)
+	w := httptest.NewRecorder()
+
+	// Serve the request through the router
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	// Check the spans form one tree under the server span
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	require.Len(t, spans, 8)
+
+	serverSpan := spans["GET /v1/memes"]
+	require.NotNil(t, serverSpan)
+	assert.False(t, serverSpan.Parent().IsValid())
+	assert.Equal(t, codes.Unset, serverSpan.Status().Code)
+
+	for _, tc := range []struct {
+		name   string
+		parent string
+		kind   trace.SpanKind
+		status codes.Code
+	}{
+		{"MemeService.CheckTokenBalance", "GET /v1/memes", trace.SpanKindInternal, codes.Unset},
+		{"MemeRepository.GetTokenBalance", "MemeService.CheckTokenBalance", trace.SpanKindClient, codes.Unset},
+		{"MemeService.GetMeme", "GET /v1/memes", trace.SpanKindInternal, codes.Unset},
+		{"MemeRepository.ReserveToken", "MemeService.GetMeme", trace.SpanKindClient, codes.Unset},
+		{"MemeRepository.SearchMemes", "MemeService.GetMeme", trace.SpanKindClient, codes.Unset},
+		{"MemeRepository.GetMemeCandidates", "MemeService.GetMeme", trace.SpanKindClient, codes.Unset},
+		{"MemeRepository.LogAPICall", "MemeService.GetMeme", trace.SpanKindClient, codes.Error},
+	} {
+		span, parent := spans[tc.name], spans[tc.parent]
+		require.NotNil(t, span, tc.name)
+		assert.Equal(t, serverSpan.SpanContext().TraceID(), span.SpanContext().TraceID(), tc.name)
+		assert.Equal(t, parent.SpanContext().SpanID(), span.Parent().SpanID(), tc.name)
+		assert.Equal(t, tc.kind, span.SpanKind(), tc.name)
+		assert.Equal(t, tc.status, span.Status().Code, tc.name)
+	}
+	assert.Equal(t, "disk full", spans["MemeRepository.LogAPICall"].Status().Description)
+}
@@ -0,0 +1,222 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"maas/internal/geo"
+	"maas/pkg/service"
+)
+
+// Request limits enforced by validation.
+const (
+	maxQueryLength          = 200 // Characters in the query of GET /v1/memes
+	maxClientNameLength     = 100
+	maxInitialTokens        = math.MaxInt32 // Largest balance the clients table can hold
+	maxIdempotencyKeyLength = 255
+)
+
+// FieldError describes why a single request field is invalid.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every invalid field of a request.
+type ValidationError struct {
+	Fields []FieldError `json:"fields"`
+}
+
+// Error implements the error interface.
+func (e *ValidationError) Error() string {
+	problems := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		problems[i] = f.Field + " " + f.Message
+	}
+	return "invalid request: " + strings.Join(problems, "; ")
+}
+
+// add records that field is invalid. Only the first problem with each field
+// is kept.
+func (e *ValidationError) add(field, message string) {
+	if !e.failed(field) {
+		e.Fields = append(e.Fields, FieldError{Field: field, Message: message})
+	}
+}
+
+// check records that field is invalid unless ok.
+func (e *ValidationError) check(ok bool, field, message string) {
+	if !ok {
+		e.add(field, message)
+	}
+}
+
+// failed reports whether a problem has been recorded for field.
+func (e *ValidationError) failed(field string) bool {
+	for _, f := range e.Fields {
+		if f.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+// err returns e if any field is invalid, and nil otherwise.
+func (e *ValidationError) err() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+// PageRequest represents the query of a paginated listing.
+type PageRequest struct {
+	Cursor int64 // NextCursor of the previous page, or zero for the first page
+	Limit  int   // Zero for the default page size
+}
+
+// parseMemeRequest validates the query of GET /v1/memes.
+func parseMemeRequest(q url.Values) (service.MemeRequest, error) {
+	var v ValidationError
+	var req service.MemeRequest
+
+	latitude, longitude := q.Get("lat"), q.Get("lon")
+	switch {
+	case latitude == "" && longitude == "":
+		// No location.
+	case latitude == "":
+		v.add("lat", "is required when lon is given")
+	case longitude == "":
+		v.add("lon", "is required when lat is given")
+	default:
+		lat, err := geo.ParseLatitude(latitude)
+		if err != nil {
+			v.add("lat", err.Error())
+		}
+		lon, err := geo.ParseLongitude(longitude)
+		if err != nil {
+			v.add("lon", err.Error())
+		}
+		req.Location = &geo.Point{Latitude: lat, Longitude: lon}
+	}
+
+	req.Query = q.Get("query")
+	v.check(utf8.ValidString(req.Query), "query", "must be valid UTF-8")
+	v.check(utf8.RuneCountInString(req.Query) <= maxQueryLength, "query", "must be at most "+strconv.Itoa(maxQueryLength)+" characters")
+
+	return req, v.err()
+}
+
+// decodeAddTokensRequest validates the body and headers of POST /v1/tokens.
+func decodeAddTokensRequest(r *http.Request, maxAmount int) (service.AddTokensRequest, error) {
+	var v ValidationError
+	var req service.AddTokensRequest
+
+	if decodeJSON(r, &req, &v) {
+		v.check(req.Amount >= 1 && req.Amount <= maxAmount, "amount", "must be between 1 and "+strconv.Itoa(maxAmount))
+	}
+	v.check(len(r.Header.Get("Idempotency-Key")) <= maxIdempotencyKeyLength, "Idempotency-Key",
+		"must be at most "+strconv.Itoa(maxIdempotencyKeyLength)+" bytes")
+
+	return req, v.err()
+}
+
+// decodeCreateClientRequest validates the body of POST /admin/clients.
+func decodeCreateClientRequest(r *http.Request) (service.CreateClientRequest, error) {
+	var v ValidationError
+	var req service.CreateClientRequest
+
+	if decodeJSON(r, &req, &v) {
+		v.check(req.Name != "" && utf8.RuneCountInString(req.Name) <= maxClientNameLength, "name",
+			"must be between 1 and "+strconv.Itoa(maxClientNameLength)+" characters")
+		v.check(req.InitialTokens >= 0 && req.InitialTokens <= maxInitialTokens, "initial_tokens",
+			"must be between 0 and "+strconv.Itoa(maxInitialTokens))
+	}
+
+	return req, v.err()
+}
+
+// parsePageRequest validates the cursor and limit of a paginated listing.
+// maxCursor bounds the cursor to the range of the IDs being paged through.
+func parsePageRequest(q url.Values, maxCursor int64) (PageRequest, error) {
+	var v ValidationError
+	var req PageRequest
+
+	if s := q.Get("cursor"); s != "" {
+		c, err := strconv.ParseInt(s, 10, 64)
+		v.check(err == nil && c >= 0 && c <= maxCursor, "cursor", "must be an integer between 0 and "+strconv.FormatInt(maxCursor, 10))
+		req.Cursor = c
+	}
+	if s := q.Get("limit"); s != "" {
+		l, err := strconv.Atoi(s)
+		v.check(err == nil && l >= 0, "limit", "must be a non-negative integer")
+		req.Limit = l
+	}
+
+	return req, v.err()
+}
+
+// parseClientID validates the {id} route variable of the admin API.
+func parseClientID(s string) (int, error) {
+	var v ValidationError
+
+	id, err := strconv.Atoi(s)
+	v.check(err == nil && id > 0 && id <= math.MaxInt32, "id", "must be a positive integer")
+
+	return id, v.err()
+}
+
+// decodeJSON decodes the JSON request body into dst, recording malformed
+// bodies, unknown fields and values of the wrong type in v. It reports
+// whether the body was decoded well enough for its fields to be checked.
+func decodeJSON(r *http.Request, dst interface{}, v *ValidationError) bool {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(dst)
+
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case err == nil:
+		return true
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		v.add(typeErr.Field, typeErrorMessage(typeErr))
+		return true
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field, _ := strconv.Unquote(strings.TrimPrefix(err.Error(), "json: unknown field "))
+		v.add(field, "is not a known field")
+		return true
+	default:
+		v.add("body", "must be a JSON object")
+		return false
+	}
+}
+
+// typeErrorMessage describes a JSON value of the wrong type the way a
+// client would think of it.
+func typeErrorMessage(e *json.UnmarshalTypeError) string {
+	switch e.Type.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		// Whole numbers that do not fit are out of range rather than of the
+		// wrong type.
+		if f, err := strconv.ParseFloat(strings.TrimPrefix(e.Value, "number "), 64); err == nil && f == math.Trunc(f) {
+			return "is out of range"
+		}
+		return "must be an integer"
+	case reflect.Float32, reflect.Float64:
+		return "must be a number"
+	case reflect.String:
+		return "must be a string"
+	case reflect.Bool:
+		return "must be a boolean"
+	default:
+		return "has the wrong type"
+	}
+}
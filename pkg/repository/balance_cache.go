@@ -0,0 +1,266 @@
+package repository
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"sync"
+	"time"
+
+	"maas/internal/config"
+)
+
+// BalanceCache keeps the clients behind recently used API keys, and their
+// token balances and rate limits, in memory so that a request does not have to look its
+// client up in the database at every step. Balances are written through by
+// the repository's token operations; a key is trusted for the configured TTL
+// and the least recently used keys are evicted beyond the configured size.
+//
+// The cache only saves lookups. Spending tokens still locks the client row
+// and checks the balance in the database, so a stale balance can never
+// overdraw a client. Changes made by other processes, such as other
+// replicas, and changes to rate limits are seen once the TTL has passed.
+//
+// A nil *BalanceCache caches nothing. It is safe for concurrent use.
+type BalanceCache struct {
+	size int
+	ttl  time.Duration
+	now  func() time.Time
+
+	mu      sync.Mutex
+	lru     *list.List // Of *cachedKey, most recently used first
+	keys    map[[sha256.Size]byte]*list.Element
+	clients map[int]*cachedClient
+
+	// Reads and writes are ordered by tickets drawn from seq, so that a
+	// balance read from the database is only cached when no write to the
+	// same client overlapped the read. floor is the latest ticket of any
+	// client entry that has been discarded.
+	seq   uint64
+	floor uint64
+}
+
+// cachedKey is an API key, stored as its digest, and the client it belongs to.
+type cachedKey struct {
+	digest   [sha256.Size]byte
+	clientID int
+	expires  time.Time
+}
+
+// cachedClient is the state shared by all the cached keys of a client.
+type cachedClient struct {
+	keys        int // Cached keys belonging to the client
+	balance     int
+	hasBalance  bool
+	rate        int // Requests per minute, as last read from the database
+	burst       int
+	applied     uint64 // Ticket of the read or write the balance came from
+	changed     uint64 // Ticket of the latest write to start or finish
+	invalidated uint64 // Ticket of the latest change to the client's keys or status
+	writing     int    // Writes in progress
+}
+
+// NewBalanceCache creates a cache as configured by cfg. It returns nil, a
+// cache that caches nothing, when cfg.Size is zero.
+func NewBalanceCache(cfg config.BalanceCacheConfig) *BalanceCache {
+	if cfg.Size <= 0 {
+		return nil
+	}
+	return &BalanceCache{
+		size:    cfg.Size,
+		ttl:     time.Duration(cfg.TTL) * time.Second,
+		now:     time.Now,
+		lru:     list.New(),
+		keys:    make(map[[sha256.Size]byte]*list.Element),
+		clients: make(map[int]*cachedClient),
+	}
+}
+
+// lookup returns the client, with its balance and rate limit, cached for
+// authToken.
+func (c *BalanceCache) lookup(authToken string) (_ authClient, ok bool) {
+	if c == nil {
+		return authClient{}, false
+	}
+	digest := sha256.Sum256([]byte(authToken))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.keys[digest]
+	if !ok {
+		return authClient{}, false
+	}
+	key := el.Value.(*cachedKey)
+	if !c.now().Before(key.expires) {
+		c.removeKey(el)
+		return authClient{}, false
+	}
+	client := c.clients[key.clientID]
+	if !client.hasBalance {
+		return authClient{}, false
+	}
+	c.lru.MoveToFront(el)
+	return authClient{
+		clientID:          key.clientID,
+		tokenBalance:      client.balance,
+		requestsPerMinute: client.rate,
+		burst:             client.burst,
+	}, true
+}
+
+// startRead returns the ticket to pass to store for a client about to be
+// read from the database.
+func (c *BalanceCache) startRead() uint64 {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.nextTicket()
+}
+
+// store caches authToken as a key of a client read from the database after
+// ticket was drawn from startRead. The key is not cached if the client's keys
+// or status changed since; the balance is not if a write to the client
+// overlapped the read.
+func (c *BalanceCache) store(authToken string, read authClient, ticket uint64) {
+	if c == nil {
+		return
+	}
+	clientID := read.clientID
+	digest := sha256.Sum256([]byte(authToken))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	client, ok := c.clients[clientID]
+	if !ok {
+		if ticket <= c.floor {
+			return // What happened to the client since the read is forgotten
+		}
+		client = &cachedClient{}
+		c.clients[clientID] = client
+	}
+	if client.invalidated >= ticket {
+		c.release(clientID, client)
+		return
+	}
+	if client.writing == 0 && client.changed < ticket {
+		client.balance, client.hasBalance, client.applied = read.tokenBalance, true, ticket
+	}
+	client.rate, client.burst = read.requestsPerMinute, read.burst
+
+	expires := c.now().Add(c.ttl)
+	if el, ok := c.keys[digest]; ok {
+		key := el.Value.(*cachedKey)
+		if key.clientID == clientID {
+			key.expires = expires
+			c.lru.MoveToFront(el)
+			return
+		}
+		c.removeKey(el)
+	}
+	c.keys[digest] = c.lru.PushFront(&cachedKey{digest: digest, clientID: clientID, expires: expires})
+	client.keys++
+
+	for c.lru.Len() > c.size {
+		c.removeKey(c.lru.Back())
+	}
+}
+
+// startWrite records that a write to clientID's balance has begun. It must
+// be called while the client row is locked, so that tickets follow the order
+// in which writes take the lock, and be followed by finishWrite.
+func (c *BalanceCache) startWrite(clientID int) uint64 {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	client, ok := c.clients[clientID]
+	if !ok {
+		client = &cachedClient{}
+		c.clients[clientID] = client
+	}
+	client.writing++
+	client.changed = c.nextTicket()
+	return client.changed
+}
+
+// finishWrite records the end of the write started with ticket. known
+// reports whether tokenBalance is the client's balance once the write is
+// over; when it is not, the cached balance is dropped.
+func (c *BalanceCache) finishWrite(clientID int, ticket uint64, tokenBalance int, known bool) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	client := c.clients[clientID]
+	client.writing--
+	client.changed = c.nextTicket()
+	if ticket > client.applied {
+		client.balance, client.hasBalance, client.applied = tokenBalance, known, ticket
+	}
+	c.release(clientID, client)
+}
+
+// invalidate forgets clientID's cached keys and balance, after the client's
+// keys or status have changed.
+func (c *BalanceCache) invalidate(clientID int) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if client, ok := c.clients[clientID]; ok {
+		for el := c.lru.Front(); el != nil && client.keys > 0; {
+			next := el.Next()
+			if el.Value.(*cachedKey).clientID == clientID {
+				c.removeKey(el)
+			}
+			el = next
+		}
+	}
+
+	client, ok := c.clients[clientID]
+	if !ok {
+		// Reads of the client in progress must not be cached. Without an
+		// entry to record the change on, no read in progress is.
+		c.floor = c.nextTicket()
+		return
+	}
+	client.hasBalance = false
+	client.invalidated = c.nextTicket()
+	client.changed = client.invalidated
+}
+
+// removeKey removes a key, and its client once nothing refers to it.
+// c.mu must be held.
+func (c *BalanceCache) removeKey(el *list.Element) {
+	key := c.lru.Remove(el).(*cachedKey)
+	delete(c.keys, key.digest)
+	client := c.clients[key.clientID]
+	client.keys--
+	c.release(key.clientID, client)
+}
+
+// release discards client once it has no cached keys and no writes in
+// progress. Reads that started before it was discarded are not cached.
+// c.mu must be held.
+func (c *BalanceCache) release(clientID int, client *cachedClient) {
+	if client.keys > 0 || client.writing > 0 {
+		return
+	}
+	delete(c.clients, clientID)
+	c.floor = max(c.floor, client.applied, client.changed, client.invalidated)
+}
+
+// nextTicket draws a ticket. c.mu must be held.
+func (c *BalanceCache) nextTicket() uint64 {
+	c.seq++
+	return c.seq
+}
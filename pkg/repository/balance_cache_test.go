@@ -0,0 +1,355 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"maas/internal/apikey"
+	"maas/internal/config"
+	"maas/internal/store"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestBalanceCache returns a cache whose clock only moves when the
+// returned function is called.
+func newTestBalanceCache(size int) (*BalanceCache, func(d time.Duration)) {
+	c := NewBalanceCache(config.BalanceCacheConfig{Size: size, TTL: 30})
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+	return c, func(d time.Duration) { now = now.Add(d) }
+}
+
+// cacheRead stores a balance read from the database as authenticate does.
+func cacheRead(c *BalanceCache, authToken string, clientID, tokenBalance int) {
+	c.store(authToken, authClient{clientID: clientID, tokenBalance: tokenBalance}, c.startRead())
+}
+
+// cacheWrite writes a balance through as withClient does.
+func cacheWrite(c *BalanceCache, clientID, tokenBalance int) {
+	c.finishWrite(clientID, c.startWrite(clientID), tokenBalance, true)
+}
+
+func TestBalanceCache(t *testing.T) {
+	t.Run("Lookup", func(t *testing.T) {
+		c, _ := newTestBalanceCache(10)
+		cacheRead(c, "key_a", 7, 100)
+
+		client, ok := c.lookup("key_a")
+		assert.True(t, ok)
+		assert.Equal(t, 7, client.clientID)
+		assert.Equal(t, 100, client.tokenBalance)
+
+		_, ok = c.lookup("key_b")
+		assert.False(t, ok)
+	})
+
+	t.Run("Expires After TTL", func(t *testing.T) {
+		c, advance := newTestBalanceCache(10)
+		cacheRead(c, "key_a", 7, 100)
+
+		advance(29 * time.Second)
+		_, ok := c.lookup("key_a")
+		assert.True(t, ok)
+
+		// Writing the balance through does not extend the key's life
+		cacheWrite(c, 7, 99)
+		advance(time.Second)
+		_, ok = c.lookup("key_a")
+		assert.False(t, ok)
+		assert.Empty(t, c.clients)
+	})
+
+	t.Run("Evicts Least Recently Used", func(t *testing.T) {
+		c, _ := newTestBalanceCache(2)
+		cacheRead(c, "key_a", 7, 100)
+		cacheRead(c, "key_b", 8, 200)
+		c.lookup("key_a")
+		cacheRead(c, "key_c", 9, 300)
+
+		_, ok := c.lookup("key_b")
+		assert.False(t, ok)
+		_, ok = c.lookup("key_a")
+		assert.True(t, ok)
+		_, ok = c.lookup("key_c")
+		assert.True(t, ok)
+		assert.Equal(t, 2, c.lru.Len())
+		assert.Len(t, c.clients, 2)
+	})
+
+	t.Run("Writes Through", func(t *testing.T) {
+		c, _ := newTestBalanceCache(10)
+		cacheRead(c, "key_a", 7, 100)
+		cacheRead(c, "key_b", 7, 100)
+
+		cacheWrite(c, 7, 99)
+
+		// Every key of the client sees the new balance
+		client, _ := c.lookup("key_a")
+		assert.Equal(t, 99, client.tokenBalance)
+		client, _ = c.lookup("key_b")
+		assert.Equal(t, 99, client.tokenBalance)
+	})
+
+	t.Run("Failed Commit Drops Balance", func(t *testing.T) {
+		c, _ := newTestBalanceCache(10)
+		cacheRead(c, "key_a", 7, 100)
+
+		c.finishWrite(7, c.startWrite(7), 99, false)
+
+		_, ok := c.lookup("key_a")
+		assert.False(t, ok)
+	})
+
+	t.Run("Read Overlapping Write Keeps Newer Balance", func(t *testing.T) {
+		c, _ := newTestBalanceCache(10)
+		cacheRead(c, "key_a", 7, 100)
+
+		// A read starts, then a write commits before the read is stored
+		ticket := c.startRead()
+		cacheWrite(c, 7, 99)
+		c.store("key_a", authClient{clientID: 7, tokenBalance: 100}, ticket)
+
+		client, _ := c.lookup("key_a")
+		assert.Equal(t, 99, client.tokenBalance)
+	})
+
+	t.Run("Read During Write Is Not Cached", func(t *testing.T) {
+		c, _ := newTestBalanceCache(10)
+
+		// A write is in progress when the read is stored
+		writeTicket := c.startWrite(7)
+		cacheRead(c, "key_a", 7, 100)
+		_, ok := c.lookup("key_a")
+		assert.False(t, ok)
+
+		// Its result is written through once it is over
+		c.finishWrite(7, writeTicket, 99, true)
+		client, ok := c.lookup("key_a")
+		assert.True(t, ok)
+		assert.Equal(t, 99, client.tokenBalance)
+	})
+
+	t.Run("Writes Apply In Lock Order", func(t *testing.T) {
+		c, _ := newTestBalanceCache(10)
+		cacheRead(c, "key_a", 7, 100)
+
+		// The first writer is slower to report than the second
+		first := c.startWrite(7)
+		second := c.startWrite(7)
+		c.finishWrite(7, second, 98, true)
+		c.finishWrite(7, first, 99, true)
+
+		client, _ := c.lookup("key_a")
+		assert.Equal(t, 98, client.tokenBalance)
+	})
+
+	t.Run("Invalidate", func(t *testing.T) {
+		c, _ := newTestBalanceCache(10)
+		cacheRead(c, "key_a", 7, 100)
+		cacheRead(c, "key_b", 8, 200)
+
+		// A read of the client's old key is in progress when it is rotated
+		ticket := c.startRead()
+		c.invalidate(7)
+		c.store("key_a", authClient{clientID: 7, tokenBalance: 100}, ticket)
+
+		_, ok := c.lookup("key_a")
+		assert.False(t, ok)
+		_, ok = c.lookup("key_b")
+		assert.True(t, ok)
+
+		// Reads that start afterwards are cached again
+		cacheRead(c, "key_c", 7, 100)
+		_, ok = c.lookup("key_c")
+		assert.True(t, ok)
+	})
+
+	t.Run("Invalidate Uncached Client", func(t *testing.T) {
+		c, _ := newTestBalanceCache(10)
+
+		ticket := c.startRead()
+		c.invalidate(7)
+		c.store("key_a", authClient{clientID: 7, tokenBalance: 100}, ticket)
+
+		_, ok := c.lookup("key_a")
+		assert.False(t, ok)
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		c := NewBalanceCache(config.BalanceCacheConfig{})
+		require.Nil(t, c)
+
+		cacheRead(c, "key_a", 7, 100)
+		cacheWrite(c, 7, 99)
+		c.invalidate(7)
+		_, ok := c.lookup("key_a")
+		assert.False(t, ok)
+	})
+}
+
+func TestBalanceCacheConcurrent(t *testing.T) {
+	c := NewBalanceCache(config.BalanceCacheConfig{Size: 8, TTL: 30})
+
+	// Each client's balance only goes down, and writes to a client are
+	// serialized as the row lock would serialize them.
+	const clients, writes = 4, 200
+	var locks [clients]sync.Mutex
+	var balances [clients]int
+	var wg sync.WaitGroup
+	for i := 0; i < clients*writes; i++ {
+		clientID := i % clients
+		authToken := fmt.Sprintf("key_%d_%d", clientID, i%3)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			locks[clientID].Lock()
+			ticket := c.startWrite(clientID)
+			balances[clientID]--
+			balance := balances[clientID]
+			locks[clientID].Unlock()
+			c.finishWrite(clientID, ticket, balance, true)
+		}()
+		go func() {
+			defer wg.Done()
+			if _, ok := c.lookup(authToken); ok {
+				return
+			}
+			ticket := c.startRead()
+			locks[clientID].Lock()
+			balance := balances[clientID]
+			locks[clientID].Unlock()
+			c.store(authToken, authClient{clientID: clientID, tokenBalance: balance}, ticket)
+		}()
+	}
+	wg.Wait()
+
+	// Whatever is cached is the final balance
+	for clientID := 0; clientID < clients; clientID++ {
+		cacheRead(c, fmt.Sprintf("key_%d_final", clientID), clientID, balances[clientID])
+		for k := 0; k < 3; k++ {
+			if client, ok := c.lookup(fmt.Sprintf("key_%d_%d", clientID, k)); ok {
+				assert.Equal(t, -writes, client.tokenBalance)
+			}
+		}
+	}
+}
+
+// BenchmarkMemeRequest makes the repository calls that serve GET /memes for
+// one client and reports the database queries each request needs, with and
+// without the cache.
+func BenchmarkMemeRequest(b *testing.B) {
+	for _, bc := range []struct {
+		name  string
+		cache *BalanceCache
+	}{
+		{"Uncached", nil},
+		{"Cached", NewBalanceCache(config.BalanceCacheConfig{Size: 100, TTL: 30})},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			key, err := apikey.Generate()
+			require.NoError(b, err)
+			fake := &countingDB{key: key, balance: b.N + 1}
+			repo := NewMemeRepository(sql.OpenDB(fake), bc.cache, nil)
+			ctx := context.Background()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := repo.GetRateLimit(ctx, key.Token); err != nil {
+					b.Fatal(err)
+				}
+				if _, err := repo.GetTokenBalance(ctx, key.Token); err != nil {
+					b.Fatal(err)
+				}
+				if err := repo.ReserveToken(ctx, key.Token, store.LedgerMeta{}); err != nil {
+					b.Fatal(err)
+				}
+				if err := repo.LogAPICall(ctx, key.Token); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(fake.queries.Load())/float64(b.N), "queries/op")
+		})
+	}
+}
+
+// countingDB is a database/sql driver standing in for a database holding a
+// single client. It counts the statements run against it.
+type countingDB struct {
+	key     apikey.Key
+	queries atomic.Int64
+
+	mu      sync.Mutex
+	balance int
+}
+
+func (d *countingDB) Connect(context.Context) (driver.Conn, error) { return countingConn{d}, nil }
+func (d *countingDB) Driver() driver.Driver                        { return nil }
+
+type countingConn struct{ db *countingDB }
+
+func (c countingConn) Prepare(query string) (driver.Stmt, error) {
+	return countingStmt{db: c.db, query: query}, nil
+}
+func (c countingConn) Close() error              { return nil }
+func (c countingConn) Begin() (driver.Tx, error) { return c, nil }
+func (c countingConn) Commit() error             { return nil }
+func (c countingConn) Rollback() error           { return nil }
+
+type countingStmt struct {
+	db    *countingDB
+	query string
+}
+
+func (s countingStmt) Close() error  { return nil }
+func (s countingStmt) NumInput() int { return -1 }
+
+func (s countingStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.db.queries.Add(1)
+	return driver.RowsAffected(1), nil
+}
+
+func (s countingStmt) Query(args []driver.Value) (driver.Rows, error) {
+	d := s.db
+	d.queries.Add(1)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	switch {
+	case strings.HasPrefix(s.query, "SELECT client_id, token_balance, key_salt, key_hash"):
+		return &countingRows{values: []driver.Value{int64(7), int64(d.balance), d.key.Salt, d.key.Hash, false, int64(0), int64(0)}}, nil
+	case strings.HasPrefix(s.query, "SELECT token_balance FROM clients"):
+		return &countingRows{values: []driver.Value{int64(d.balance)}}, nil
+	case strings.HasPrefix(s.query, "UPDATE clients SET token_balance"):
+		d.balance += int(args[0].(int64))
+		return &countingRows{values: []driver.Value{int64(d.balance)}}, nil
+	}
+	return nil, fmt.Errorf("unexpected query %q", s.query)
+}
+
+// countingRows is a single row of values.
+type countingRows struct {
+	values []driver.Value
+	done   bool
+}
+
+func (r *countingRows) Columns() []string { return make([]string, len(r.values)) }
+func (r *countingRows) Close() error      { return nil }
+
+func (r *countingRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	copy(dest, r.values)
+	r.done = true
+	return nil
+}
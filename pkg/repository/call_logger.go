@@ -0,0 +1,203 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"maas/internal/config"
+	"maas/internal/store"
+)
+
+// ErrCallLogClosed is returned when a call is logged after the call log has
+// been closed.
+var ErrCallLogClosed = errors.New("call log is closed")
+
+// callLogWriteTimeout bounds the writing of one batch of calls.
+const callLogWriteTimeout = 10 * time.Second
+
+// CallLogger records API calls in the api_calls table off the request path.
+// Calls are queued in memory and written by a background worker, in batches
+// of up to the configured size or once the flush interval has passed. When
+// the queue is full, a call either waits for room or is dropped, as
+// configured; both are counted in Stats.
+//
+// Calls still queued when the process exits without Close are lost.
+type CallLogger struct {
+	db            *sql.DB
+	batchSize     int
+	flushInterval time.Duration
+	block         bool
+
+	// mu guards closing the queue against calls being sent to it. closing
+	// is closed first, to wake the senders waiting for room, so that Close
+	// never waits on them.
+	mu        sync.RWMutex
+	closed    bool
+	queue     chan store.APICall
+	closing   chan struct{}
+	closeOnce sync.Once
+	done      chan struct{}
+
+	written         atomic.Int64
+	failed          atomic.Int64
+	dropped         atomic.Int64
+	blocked         atomic.Int64
+	blockedDuration atomic.Int64 // Nanoseconds
+}
+
+// NewCallLogger creates a call logger writing to db and starts its worker.
+// Stop it with Close.
+func NewCallLogger(db *sql.DB, cfg config.CallLogConfig) *CallLogger {
+	l := &CallLogger{
+		db:            db,
+		batchSize:     cfg.BatchSize,
+		flushInterval: time.Duration(cfg.FlushInterval) * time.Millisecond,
+		block:         cfg.Overflow == config.CallLogOverflowBlock,
+		queue:         make(chan store.APICall, cfg.QueueSize),
+		closing:       make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	go l.run()
+	return l
+}
+
+// Log queues a call by clientID. When the queue is full it waits for room
+// until ctx is done or the log is closed, or drops the call, as configured.
+// A dropped call is counted rather than reported as an error.
+func (l *CallLogger) Log(ctx context.Context, clientID int) error {
+	call := store.APICall{ClientID: clientID, Timestamp: time.Now()}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if l.closed {
+		l.dropped.Add(1)
+		return ErrCallLogClosed
+	}
+
+	select {
+	case l.queue <- call:
+		return nil
+	default:
+	}
+
+	if !l.block {
+		l.dropped.Add(1)
+		return nil
+	}
+
+	l.blocked.Add(1)
+	start := time.Now()
+	defer func() { l.blockedDuration.Add(int64(time.Since(start))) }()
+	select {
+	case l.queue <- call:
+		return nil
+	case <-ctx.Done():
+		l.dropped.Add(1)
+		return ctx.Err()
+	case <-l.closing:
+		l.dropped.Add(1)
+		return ErrCallLogClosed
+	}
+}
+
+// Close stops accepting calls and waits, until ctx is done, for the calls
+// already queued to be written.
+func (l *CallLogger) Close(ctx context.Context) error {
+	l.closeOnce.Do(func() { close(l.closing) })
+	l.mu.Lock()
+	if !l.closed {
+		l.closed = true
+		close(l.queue)
+	}
+	l.mu.Unlock()
+
+	select {
+	case <-l.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%d API calls not written: %w", len(l.queue), ctx.Err())
+	}
+}
+
+// Stats returns a snapshot of the call log.
+func (l *CallLogger) Stats() store.CallLogStats {
+	return store.CallLogStats{
+		Queued:          len(l.queue),
+		Capacity:        cap(l.queue),
+		Written:         l.written.Load(),
+		Failed:          l.failed.Load(),
+		Dropped:         l.dropped.Load(),
+		Blocked:         l.blocked.Load(),
+		BlockedDuration: time.Duration(l.blockedDuration.Load()),
+	}
+}
+
+// run is the worker. It collects queued calls into batches and writes each
+// batch once it is full or the flush interval has passed, until the queue is
+// closed and drained.
+func (l *CallLogger) run() {
+	defer close(l.done)
+
+	ticker := time.NewTicker(l.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]store.APICall, 0, l.batchSize)
+	flush := func() {
+		if len(batch) > 0 {
+			l.write(batch)
+			batch = batch[:0]
+		}
+	}
+
+	for {
+		select {
+		case call, ok := <-l.queue:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, call)
+			if len(batch) == l.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// write inserts a batch of calls with a single multi-row INSERT. A batch that
+// cannot be written is logged and lost.
+func (l *CallLogger) write(batch []store.APICall) {
+	ctx, cancel := context.WithTimeout(context.Background(), callLogWriteTimeout)
+	defer cancel()
+
+	if err := l.insert(ctx, batch); err != nil {
+		l.failed.Add(int64(len(batch)))
+		slog.Error("Failed to write API calls", "calls", len(batch), "error", err)
+		return
+	}
+	l.written.Add(int64(len(batch)))
+}
+
+func (l *CallLogger) insert(ctx context.Context, batch []store.APICall) (err error) {
+	ctx, span := startSpan(ctx, "CallLogger.insert")
+	defer endSpan(ctx, span, &err)
+
+	values := make([]string, len(batch))
+	args := make([]interface{}, 0, 2*len(batch))
+	for i, call := range batch {
+		values[i] = fmt.Sprintf("($%d, $%d)", 2*i+1, 2*i+2)
+		args = append(args, call.ClientID, call.Timestamp)
+	}
+	_, err = l.db.ExecContext(ctx, "INSERT INTO api_calls (client_id, timestamp) VALUES "+strings.Join(values, ", "), args...)
+	return err
+}
@@ -0,0 +1,207 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"maas/internal/apikey"
+	"maas/internal/config"
+	"maas/pkg/repository"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestCallLogger returns a call logger writing to a mock database. The
+// logger is closed when the test ends.
+func newTestCallLogger(t *testing.T, cfg config.CallLogConfig) (*repository.CallLogger, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	l := repository.NewCallLogger(db, cfg)
+	t.Cleanup(func() { l.Close(context.Background()) })
+	return l, mock
+}
+
+// fillQueue logs a call the worker is stuck writing, then enough calls to
+// fill the queue behind it.
+func fillQueue(t *testing.T, l *repository.CallLogger) {
+	require.NoError(t, l.Log(context.Background(), 1))
+	require.Eventually(t, func() bool { return l.Stats().Queued == 0 }, time.Second, time.Millisecond)
+	for i := 0; i < l.Stats().Capacity; i++ {
+		require.NoError(t, l.Log(context.Background(), 2))
+	}
+}
+
+func TestCallLogger(t *testing.T) {
+	t.Run("Writes In Batches", func(t *testing.T) {
+		l, mock := newTestCallLogger(t, config.CallLogConfig{QueueSize: 10, BatchSize: 2, FlushInterval: 60000, Overflow: config.CallLogOverflowBlock})
+
+		// A full batch is written at once, the rest when the log is closed
+		mock.ExpectExec("INSERT INTO api_calls").
+			WithArgs(1, sqlmock.AnyArg(), 2, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectExec("INSERT INTO api_calls").
+			WithArgs(3, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		for clientID := 1; clientID <= 3; clientID++ {
+			require.NoError(t, l.Log(context.Background(), clientID))
+		}
+		require.NoError(t, l.Close(context.Background()))
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+		assert.Equal(t, int64(3), l.Stats().Written)
+	})
+
+	t.Run("Flushes On Interval", func(t *testing.T) {
+		l, mock := newTestCallLogger(t, config.CallLogConfig{QueueSize: 10, BatchSize: 100, FlushInterval: 10, Overflow: config.CallLogOverflowBlock})
+
+		mock.ExpectExec("INSERT INTO api_calls").
+			WithArgs(1, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		require.NoError(t, l.Log(context.Background(), 1))
+
+		// The call is written without waiting for a full batch or Close
+		assert.Eventually(t, func() bool { return l.Stats().Written == 1 }, time.Second, time.Millisecond)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Drops When Full", func(t *testing.T) {
+		l, mock := newTestCallLogger(t, config.CallLogConfig{QueueSize: 1, BatchSize: 1, FlushInterval: 60000, Overflow: config.CallLogOverflowDrop})
+
+		mock.ExpectExec("INSERT INTO api_calls").
+			WillDelayFor(100 * time.Millisecond).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO api_calls").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		fillQueue(t, l)
+
+		// The call is dropped without failing or holding up the caller
+		start := time.Now()
+		assert.NoError(t, l.Log(context.Background(), 3))
+		assert.Less(t, time.Since(start), 50*time.Millisecond)
+
+		require.NoError(t, l.Close(context.Background()))
+		stats := l.Stats()
+		assert.Equal(t, int64(2), stats.Written)
+		assert.Equal(t, int64(1), stats.Dropped)
+		assert.Zero(t, stats.Blocked)
+	})
+
+	t.Run("Blocks When Full", func(t *testing.T) {
+		l, mock := newTestCallLogger(t, config.CallLogConfig{QueueSize: 1, BatchSize: 1, FlushInterval: 60000, Overflow: config.CallLogOverflowBlock})
+
+		mock.ExpectExec("INSERT INTO api_calls").
+			WillDelayFor(200 * time.Millisecond).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO api_calls").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		fillQueue(t, l)
+
+		// The caller waits for room until its context is done
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		err := l.Log(ctx, 3)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+		require.NoError(t, l.Close(context.Background()))
+		stats := l.Stats()
+		assert.Equal(t, int64(2), stats.Written)
+		assert.Equal(t, int64(1), stats.Dropped)
+		assert.Equal(t, int64(1), stats.Blocked)
+		assert.GreaterOrEqual(t, stats.BlockedDuration, 20*time.Millisecond)
+	})
+
+	t.Run("Close Wakes Blocked Senders", func(t *testing.T) {
+		l, mock := newTestCallLogger(t, config.CallLogConfig{QueueSize: 1, BatchSize: 1, FlushInterval: 60000, Overflow: config.CallLogOverflowBlock})
+
+		mock.ExpectExec("INSERT INTO api_calls").
+			WillDelayFor(200 * time.Millisecond).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO api_calls").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		fillQueue(t, l)
+
+		// A caller with no deadline of its own waits for room
+		logged := make(chan error, 1)
+		go func() { logged <- l.Log(context.Background(), 3) }()
+		require.Eventually(t, func() bool { return l.Stats().Blocked == 1 }, time.Second, time.Millisecond)
+
+		// Closing gives up at its own deadline instead of waiting on the caller
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		err := l.Close(ctx)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Less(t, time.Since(start), 150*time.Millisecond)
+
+		// The caller is released, its call dropped
+		select {
+		case err := <-logged:
+			assert.ErrorIs(t, err, repository.ErrCallLogClosed)
+		case <-time.After(time.Second):
+			t.Fatal("Log still blocked after Close")
+		}
+		assert.Equal(t, int64(1), l.Stats().Dropped)
+	})
+
+	t.Run("Counts Failed Writes", func(t *testing.T) {
+		l, mock := newTestCallLogger(t, config.CallLogConfig{QueueSize: 10, BatchSize: 10, FlushInterval: 60000, Overflow: config.CallLogOverflowBlock})
+
+		mock.ExpectExec("INSERT INTO api_calls").
+			WillReturnError(errors.New("connection refused"))
+
+		require.NoError(t, l.Log(context.Background(), 1))
+		require.NoError(t, l.Log(context.Background(), 2))
+		require.NoError(t, l.Close(context.Background()))
+
+		stats := l.Stats()
+		assert.Equal(t, int64(2), stats.Failed)
+		assert.Zero(t, stats.Written)
+	})
+
+	t.Run("Closed", func(t *testing.T) {
+		l, _ := newTestCallLogger(t, config.CallLogConfig{QueueSize: 10, BatchSize: 10, FlushInterval: 60000, Overflow: config.CallLogOverflowBlock})
+		require.NoError(t, l.Close(context.Background()))
+
+		err := l.Log(context.Background(), 1)
+		assert.ErrorIs(t, err, repository.ErrCallLogClosed)
+		assert.Equal(t, int64(1), l.Stats().Dropped)
+
+		// Closing again is harmless
+		assert.NoError(t, l.Close(context.Background()))
+	})
+}
+
+func TestLogAPICallQueuesCall(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	calls := repository.NewCallLogger(db, config.CallLogConfig{QueueSize: 10, BatchSize: 10, FlushInterval: 60000, Overflow: config.CallLogOverflowBlock})
+	memeRepo := repository.NewMemeRepository(db, nil, calls)
+	key, err := apikey.Generate()
+	require.NoError(t, err)
+
+	// Logging the call only looks the client up
+	mock.ExpectQuery("SELECT client_id, token_balance, key_salt, key_hash").
+		WithArgs(key.Prefix).
+		WillReturnRows(sqlmock.NewRows([]string{"client_id", "token_balance", "key_salt", "key_hash", "disabled", "rate_limit_per_minute", "rate_limit_burst"}).
+			AddRow(7, 100, key.Salt, key.Hash, false, 0, 0))
+	require.NoError(t, memeRepo.LogAPICall(context.Background(), key.Token))
+	assert.Equal(t, 1, calls.Stats().Queued)
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	// The call is written once the log is closed
+	mock.ExpectExec("INSERT INTO api_calls").
+		WithArgs(7, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	require.NoError(t, calls.Close(context.Background()))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,161 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"maas/internal/apikey"
+	"maas/internal/store"
+)
+
+// ErrClientNotFound is returned when no client has the requested ID.
+var ErrClientNotFound = errors.New("client not found")
+
+// clientSummaryColumns selects the columns scanned by scanClientSummary.
+const clientSummaryColumns = "client_id, name, COALESCE(key_prefix, ''), token_balance, created_at, disabled_at"
+
+// ClientRepository handles database operations for managing clients.
+type ClientRepository struct {
+	db    *sql.DB
+	cache *BalanceCache
+}
+
+// NewClientRepository creates a new ClientRepository. Clients whose keys or
+// status change are dropped from cache, which may be nil.
+func NewClientRepository(db *sql.DB, cache *BalanceCache) *ClientRepository {
+	return &ClientRepository{
+		db:    db,
+		cache: cache,
+	}
+}
+
+// CreateClient inserts a new client holding key. A positive initialTokens is
+// credited through the ledger in the same transaction.
+func (r *ClientRepository) CreateClient(ctx context.Context, name string, key apikey.Key, initialTokens int, meta store.LedgerMeta) (client *store.ClientSummary, err error) {
+	ctx, span := startSpan(ctx, "ClientRepository.CreateClient")
+	defer endSpan(ctx, span, &err)
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var clientID int
+	err = tx.QueryRowContext(ctx, "INSERT INTO clients (name, key_prefix, key_salt, key_hash, token_balance) VALUES ($1, $2, $3, $4, 0) RETURNING client_id",
+		name, key.Prefix, key.Salt, key.Hash).Scan(&clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	if initialTokens > 0 {
+		if _, err = appendLedgerEntry(ctx, tx, clientID, store.LedgerCredit, initialTokens, meta); err != nil {
+			return nil, err
+		}
+	}
+
+	if client, err = scanClientSummary(tx.QueryRowContext(ctx, "SELECT "+clientSummaryColumns+" FROM clients WHERE client_id = $1", clientID)); err != nil {
+		return nil, err
+	}
+	return client, tx.Commit()
+}
+
+// ListClients returns up to limit clients ordered by ID. When after is
+// non-zero only clients with a greater ID are returned.
+func (r *ClientRepository) ListClients(ctx context.Context, after, limit int) (_ []store.ClientSummary, err error) {
+	ctx, span := startSpan(ctx, "ClientRepository.ListClients")
+	defer endSpan(ctx, span, &err)
+
+	rows, err := r.db.QueryContext(ctx, "SELECT "+clientSummaryColumns+" FROM clients WHERE client_id > $1 ORDER BY client_id LIMIT $2", after, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	clients := []store.ClientSummary{}
+	for rows.Next() {
+		client, err := scanClientSummary(rows)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, *client)
+	}
+	return clients, rows.Err()
+}
+
+// GetClient retrieves a client by ID.
+func (r *ClientRepository) GetClient(ctx context.Context, clientID int) (_ *store.ClientSummary, err error) {
+	ctx, span := startSpan(ctx, "ClientRepository.GetClient")
+	defer endSpan(ctx, span, &err)
+
+	return scanClientSummary(r.db.QueryRowContext(ctx, "SELECT "+clientSummaryColumns+" FROM clients WHERE client_id = $1", clientID))
+}
+
+// SetClientDisabled disables or re-enables a client. Disabling an already
+// disabled client keeps the original disabled_at time.
+func (r *ClientRepository) SetClientDisabled(ctx context.Context, clientID int, disabled bool) (_ *store.ClientSummary, err error) {
+	ctx, span := startSpan(ctx, "ClientRepository.SetClientDisabled")
+	defer endSpan(ctx, span, &err)
+	defer r.cache.invalidate(clientID)
+
+	query := "UPDATE clients SET disabled_at = NULL WHERE client_id = $1 RETURNING " + clientSummaryColumns
+	if disabled {
+		query = "UPDATE clients SET disabled_at = COALESCE(disabled_at, CURRENT_TIMESTAMP) WHERE client_id = $1 RETURNING " + clientSummaryColumns
+	}
+	return scanClientSummary(r.db.QueryRowContext(ctx, query, clientID))
+}
+
+// RotateClientKey replaces a client's API key with key. The old key, and any
+// legacy plaintext token, stop working immediately.
+func (r *ClientRepository) RotateClientKey(ctx context.Context, clientID int, key apikey.Key) (_ *store.ClientSummary, err error) {
+	ctx, span := startSpan(ctx, "ClientRepository.RotateClientKey")
+	defer endSpan(ctx, span, &err)
+	defer r.cache.invalidate(clientID)
+
+	return scanClientSummary(r.db.QueryRowContext(ctx, `UPDATE clients SET key_prefix = $1, key_salt = $2, key_hash = $3, auth_token = NULL
+		WHERE client_id = $4
+		RETURNING `+clientSummaryColumns, key.Prefix, key.Salt, key.Hash, clientID))
+}
+
+// ReconcileClient compares a client's stored balance with the sum of its
+// ledger entries.
+func (r *ClientRepository) ReconcileClient(ctx context.Context, clientID int) (_ *store.Reconciliation, err error) {
+	ctx, span := startSpan(ctx, "ClientRepository.ReconcileClient")
+	defer endSpan(ctx, span, &err)
+
+	rec := store.Reconciliation{ClientID: clientID}
+	err = r.db.QueryRowContext(ctx, `SELECT c.token_balance, COALESCE(SUM(l.amount), 0)
+		FROM clients c
+		LEFT JOIN token_ledger l ON l.client_id = c.client_id
+		WHERE c.client_id = $1
+		GROUP BY c.client_id, c.token_balance`, clientID).Scan(&rec.TokenBalance, &rec.LedgerBalance)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrClientNotFound
+		}
+		return nil, err
+	}
+	rec.Drift = rec.TokenBalance - rec.LedgerBalance
+	return &rec, nil
+}
+
+// scanClientSummary scans a row selected with clientSummaryColumns.
+func scanClientSummary(row interface{ Scan(...interface{}) error }) (*store.ClientSummary, error) {
+	var c store.ClientSummary
+	var disabledAt sql.NullTime
+	if err := row.Scan(&c.ClientID, &c.Name, &c.KeyPrefix, &c.TokenBalance, &c.CreatedAt, &disabledAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrClientNotFound
+		}
+		return nil, err
+	}
+	if disabledAt.Valid {
+		c.DisabledAt = &disabledAt.Time
+	}
+	return &c, nil
+}
@@ -0,0 +1,49 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+
+	"maas/pkg/repository"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReconcileClient(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	clientRepo := repository.NewClientRepository(db, nil)
+
+	t.Run("Drift", func(t *testing.T) {
+		// Set up a balance that was raised outside the ledger
+		mock.ExpectQuery("SELECT c.token_balance, COALESCE\\(SUM\\(l.amount\\), 0\\)").WithArgs(7).
+			WillReturnRows(sqlmock.NewRows([]string{"token_balance", "ledger_balance"}).AddRow(105, 100))
+
+		// Call the repository
+		rec, err := clientRepo.ReconcileClient(context.Background(), 7)
+
+		// Check the difference is reported
+		require.NoError(t, err)
+		assert.Equal(t, 105, rec.TokenBalance)
+		assert.Equal(t, 100, rec.LedgerBalance)
+		assert.Equal(t, 5, rec.Drift)
+	})
+
+	t.Run("Client Not Found", func(t *testing.T) {
+		// Set up a lookup that finds no client
+		mock.ExpectQuery("SELECT c.token_balance").WithArgs(8).
+			WillReturnRows(sqlmock.NewRows([]string{"token_balance", "ledger_balance"}))
+
+		// Call the repository
+		_, err := clientRepo.ReconcileClient(context.Background(), 8)
+
+		// Check the result
+		assert.ErrorIs(t, err, repository.ErrClientNotFound)
+	})
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
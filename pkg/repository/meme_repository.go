@@ -1,57 +1,446 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
-	"log"
+	"errors"
+	"log/slog"
+	"time"
 
+	"maas/internal/apikey"
+	"maas/internal/geo"
+	"maas/internal/logging"
 	"maas/internal/store"
+
+	"github.com/lib/pq"
 )
 
+// ErrInsufficientTokens is returned when a client has no tokens left to spend.
+var ErrInsufficientTokens = errors.New("insufficient tokens")
+
+// ErrInvalidAuthToken is returned when no client matches the auth token.
+var ErrInvalidAuthToken = errors.New("invalid authorization token")
+
+// ErrIdempotencyKeyReused is returned when an idempotency key is presented
+// again with a different request than the one it was first used for.
+var ErrIdempotencyKeyReused = errors.New("idempotency key reused with a different request")
+
+// ErrClientDisabled is returned when a valid key belongs to a disabled client.
+var ErrClientDisabled = errors.New("client is disabled")
+
+// memeColumns selects the catalog columns scanned by scanMemes.
+const memeColumns = "meme_id, text, COALESCE(image_url, ''), tags, language, created_at, active, latitude, longitude, radius_km, region"
+
 // MemeRepository handles database operations for memes.
 type MemeRepository struct {
-	db *sql.DB
+	db    *sql.DB
+	cache *BalanceCache
+	calls *CallLogger
 }
 
-// NewMemeRepository creates a new MemeRepository.
-func NewMemeRepository(db *sql.DB) *MemeRepository {
+// NewMemeRepository creates a new MemeRepository. Clients and their balances
+// are cached in cache, and API calls are written through calls; either may
+// be nil.
+func NewMemeRepository(db *sql.DB, cache *BalanceCache, calls *CallLogger) *MemeRepository {
 	return &MemeRepository{
-		db: db,
+		db:    db,
+		cache: cache,
+		calls: calls,
 	}
 }
 
-// DeductToken decrements a client's token balance by 1.
-func (r *MemeRepository) DeductToken(authToken string) error {
-	_, err := r.db.Exec("UPDATE clients SET token_balance = token_balance - 1 WHERE auth_token = $1", authToken)
+// ReserveToken atomically checks a client's balance and deducts one token,
+// recording the debit in the ledger. The client row is locked for the
+// duration of the transaction, so concurrent reservations for the same
+// client are serialized and the balance can never drop below zero.
+func (r *MemeRepository) ReserveToken(ctx context.Context, authToken string, meta store.LedgerMeta) (err error) {
+	ctx, span := startSpan(ctx, "MemeRepository.ReserveToken")
+	defer endSpan(ctx, span, &err)
+
+	return r.withClient(ctx, authToken, func(tx *sql.Tx, clientID, tokenBalance int) (int, error) {
+		if tokenBalance <= 0 {
+			return 0, ErrInsufficientTokens
+		}
+		return appendLedgerEntry(ctx, tx, clientID, store.LedgerDebit, -1, meta)
+	})
+}
+
+// RefundToken returns one previously reserved token to a client.
+func (r *MemeRepository) RefundToken(ctx context.Context, authToken string, meta store.LedgerMeta) (err error) {
+	ctx, span := startSpan(ctx, "MemeRepository.RefundToken")
+	defer endSpan(ctx, span, &err)
+
+	return r.withClient(ctx, authToken, func(tx *sql.Tx, clientID, _ int) (int, error) {
+		return appendLedgerEntry(ctx, tx, clientID, store.LedgerRefund, 1, meta)
+	})
+}
+
+// AddTokens adds tokens to a client's balance.
+func (r *MemeRepository) AddTokens(ctx context.Context, authToken string, amount int, meta store.LedgerMeta) (err error) {
+	ctx, span := startSpan(ctx, "MemeRepository.AddTokens")
+	defer endSpan(ctx, span, &err)
+
+	return r.withClient(ctx, authToken, func(tx *sql.Tx, clientID, _ int) (int, error) {
+		return appendLedgerEntry(ctx, tx, clientID, store.LedgerCredit, amount, meta)
+	})
+}
+
+// AddTokensOnce adds tokens to a client's balance at most once per
+// idempotency key. The first call credits the client and stores rec for ttl;
+// later calls with the same key and request hash return the stored record
+// marked as replayed without crediting again.
+func (r *MemeRepository) AddTokensOnce(ctx context.Context, authToken string, amount int, meta store.LedgerMeta, rec store.IdempotencyRecord, ttl time.Duration) (_ *store.IdempotencyRecord, err error) {
+	ctx, span := startSpan(ctx, "MemeRepository.AddTokensOnce")
+	defer endSpan(ctx, span, &err)
+
+	var result *store.IdempotencyRecord
+	err = r.withClient(ctx, authToken, func(tx *sql.Tx, clientID, tokenBalance int) (int, error) {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE client_id = $1 AND expires_at <= now()", clientID); err != nil {
+			return 0, err
+		}
+
+		stored := store.IdempotencyRecord{Key: rec.Key}
+		err := tx.QueryRowContext(ctx, `SELECT request_hash, status_code, response_body FROM idempotency_keys
+			WHERE client_id = $1 AND idempotency_key = $2`, clientID, rec.Key).
+			Scan(&stored.RequestHash, &stored.StatusCode, &stored.ResponseBody)
+		switch {
+		case err == nil:
+			if stored.RequestHash != rec.RequestHash {
+				return 0, ErrIdempotencyKeyReused
+			}
+			stored.Replayed = true
+			result = &stored
+			return tokenBalance, nil
+		case !errors.Is(err, sql.ErrNoRows):
+			return 0, err
+		}
+
+		balance, err := appendLedgerEntry(ctx, tx, clientID, store.LedgerCredit, amount, meta)
+		if err != nil {
+			return 0, err
+		}
+
+		_, err = tx.ExecContext(ctx, `INSERT INTO idempotency_keys (client_id, idempotency_key, request_hash, status_code, response_body, expires_at)
+			VALUES ($1, $2, $3, $4, $5, now() + make_interval(secs => $6))`,
+			clientID, rec.Key, rec.RequestHash, rec.StatusCode, rec.ResponseBody, ttl.Seconds())
+		if err != nil {
+			return 0, err
+		}
+		result = &rec
+		return balance, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// withClient runs fn inside a transaction holding a row lock on the client
+// identified by authToken. The transaction is committed if fn succeeds and
+// rolled back otherwise. fn returns the client's balance once it has run,
+// which is written through to the cache.
+func (r *MemeRepository) withClient(ctx context.Context, authToken string, fn func(tx *sql.Tx, clientID, tokenBalance int) (int, error)) (err error) {
+	client, err := r.authenticate(ctx, authToken)
+	if err != nil {
+		return err
+	}
+	clientID := client.clientID
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var tokenBalance int
+	err = tx.QueryRowContext(ctx, "SELECT token_balance FROM clients WHERE client_id = $1 FOR UPDATE", clientID).Scan(&tokenBalance)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInvalidAuthToken
+		}
+		return err
+	}
+
+	// Tickets for cached balances are drawn while the row is locked, so that
+	// they follow the order of the writes.
+	ticket := r.cache.startWrite(clientID)
+	balance, err := fn(tx, clientID, tokenBalance)
+	if err != nil {
+		// Rolling back leaves the balance as it was.
+		r.cache.finishWrite(clientID, ticket, tokenBalance, true)
+		return err
+	}
+
+	err = tx.Commit()
+	r.cache.finishWrite(clientID, ticket, balance, err == nil)
 	return err
 }
 
-// LogAPICall records an API call in the database.
-func (r *MemeRepository) LogAPICall(authToken string) error {
-	var clientID int
-	err := r.db.QueryRow("SELECT client_id FROM clients WHERE auth_token = $1", authToken).Scan(&clientID)
+// appendLedgerEntry applies amount to the client's balance and records the
+// change in the ledger, returning the new balance. It must be called with the
+// client row locked.
+func appendLedgerEntry(ctx context.Context, tx *sql.Tx, clientID int, kind string, amount int, meta store.LedgerMeta) (int, error) {
+	var balanceAfter int
+	err := tx.QueryRowContext(ctx, "UPDATE clients SET token_balance = token_balance + $1 WHERE client_id = $2 RETURNING token_balance",
+		amount, clientID).Scan(&balanceAfter)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO token_ledger (client_id, kind, amount, balance_after, reason, actor, reference_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		clientID, kind, amount, balanceAfter, meta.Reason, meta.Actor, meta.ReferenceID)
+	if err != nil {
+		return 0, err
+	}
+	return balanceAfter, nil
+}
+
+// ListLedgerEntries returns up to limit ledger entries for a client, newest
+// first. When before is non-zero only entries older than it are returned.
+func (r *MemeRepository) ListLedgerEntries(ctx context.Context, authToken string, before int64, limit int) (_ []store.LedgerEntry, err error) {
+	ctx, span := startSpan(ctx, "MemeRepository.ListLedgerEntries")
+	defer endSpan(ctx, span, &err)
+
+	client, err := r.authenticate(ctx, authToken)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT entry_id, client_id, kind, amount, balance_after, reason, actor, reference_id, created_at
+		FROM token_ledger
+		WHERE client_id = $1 AND ($2 = 0 OR entry_id < $2)
+		ORDER BY entry_id DESC
+		LIMIT $3`, client.clientID, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []store.LedgerEntry{}
+	for rows.Next() {
+		var e store.LedgerEntry
+		if err := rows.Scan(&e.EntryID, &e.ClientID, &e.Kind, &e.Amount, &e.BalanceAfter,
+			&e.Reason, &e.Actor, &e.ReferenceID, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// GetMemeCandidates returns up to limit active memes from the catalog, those
+// best suited to a caller at location first and in random order otherwise.
+// location may be nil.
+func (r *MemeRepository) GetMemeCandidates(ctx context.Context, location *geo.Point, limit int) (_ []store.Meme, err error) {
+	ctx, span := startSpan(ctx, "MemeRepository.GetMemeCandidates")
+	defer endSpan(ctx, span, &err)
+
+	lat, lon := pointArgs(location)
+	rows, err := r.db.QueryContext(ctx, `SELECT `+memeColumns+`, meme_scope_rank(memes, $1, $2) AS scope_rank
+		FROM memes
+		WHERE active
+		ORDER BY scope_rank, random()
+		LIMIT $3`, lat, lon, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanMemes(rows)
+}
+
+// SearchMemes returns up to limit active memes matching query, those best
+// suited to a caller at location first and by relevance otherwise. query
+// uses web search syntax: quoted phrases, "or" and -exclusions. location may
+// be nil.
+func (r *MemeRepository) SearchMemes(ctx context.Context, query string, location *geo.Point, limit int) (_ []store.Meme, err error) {
+	ctx, span := startSpan(ctx, "MemeRepository.SearchMemes")
+	defer endSpan(ctx, span, &err)
+
+	lat, lon := pointArgs(location)
+	rows, err := r.db.QueryContext(ctx, `SELECT `+memeColumns+`, meme_scope_rank(memes, $2, $3) AS scope_rank
+		FROM memes, websearch_to_tsquery('english', $1) AS q
+		WHERE active AND search_vector @@ q
+		ORDER BY scope_rank, ts_rank(search_vector, q) DESC, meme_id
+		LIMIT $4`, query, lat, lon, limit)
 	if err != nil {
-		return err // Handle appropriately, possibly logging the error
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanMemes(rows)
+}
+
+// pointArgs returns the query arguments for an optional location.
+func pointArgs(location *geo.Point) (lat, lon interface{}) {
+	if location == nil {
+		return nil, nil
 	}
+	return location.Latitude, location.Longitude
+}
 
-	_, err = r.db.Exec("INSERT INTO api_calls (client_id) VALUES ($1)", clientID)
+// scanMemes scans rows selected with memeColumns followed by a scope rank.
+func scanMemes(rows *sql.Rows) ([]store.Meme, error) {
+	memes := []store.Meme{}
+	for rows.Next() {
+		var m store.Meme
+		if err := rows.Scan(&m.MemeID, &m.Text, &m.ImageURL, pq.Array(&m.Tags), &m.Language, &m.CreatedAt, &m.Active,
+			&m.Latitude, &m.Longitude, &m.RadiusKM, &m.Region, &m.ScopeRank); err != nil {
+			return nil, err
+		}
+		memes = append(memes, m)
+	}
+	return memes, rows.Err()
+}
+
+// LogAPICall records an API call. With a call logger the call is queued to
+// be written in a batch; otherwise it is written at once.
+func (r *MemeRepository) LogAPICall(ctx context.Context, authToken string) (err error) {
+	ctx, span := startSpan(ctx, "MemeRepository.LogAPICall")
+	defer endSpan(ctx, span, &err)
+
+	client, err := r.authenticate(ctx, authToken)
+	if err != nil {
+		return err
+	}
+
+	if r.calls != nil {
+		return r.calls.Log(ctx, client.clientID)
+	}
+	_, err = r.db.ExecContext(ctx, "INSERT INTO api_calls (client_id) VALUES ($1)", client.clientID)
 	return err
 }
 
 // GetTokenBalance retrieves the token balance for a client.
-func (r *MemeRepository) GetTokenBalance(authToken string) (int, error) {
-	var tokenBalance int
-	err := r.db.QueryRow("SELECT token_balance FROM clients WHERE auth_token = $1", authToken).Scan(&tokenBalance)
+func (r *MemeRepository) GetTokenBalance(ctx context.Context, authToken string) (_ int, err error) {
+	ctx, span := startSpan(ctx, "MemeRepository.GetTokenBalance")
+	defer endSpan(ctx, span, &err)
+
+	client, err := r.authenticate(ctx, authToken)
+	return client.tokenBalance, err
+}
+
+// GetRateLimit retrieves a client's own rate limit. It is read along with
+// the client when the key is authenticated, so it costs no query of its own.
+func (r *MemeRepository) GetRateLimit(ctx context.Context, authToken string) (_ *store.RateLimit, err error) {
+	ctx, span := startSpan(ctx, "MemeRepository.GetRateLimit")
+	defer endSpan(ctx, span, &err)
+
+	client, err := r.authenticate(ctx, authToken)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return 0, service.ErrInvalidAuthToken
+		return nil, err
+	}
+	return &store.RateLimit{
+		ClientID:          client.clientID,
+		RequestsPerMinute: client.requestsPerMinute,
+		Burst:             client.burst,
+	}, nil
+}
+
+// authClient is what authenticating an API key finds out about its client.
+type authClient struct {
+	clientID          int
+	tokenBalance      int
+	requestsPerMinute int // Zero when the client has no rate of its own
+	burst             int // Zero when the client has no burst of its own
+}
+
+// authenticate resolves an API key to the client that owns it, returning the
+// client's ID, current balance and rate limit. Keys are looked up by prefix and their
+// secret is checked against the stored salted hash. A plaintext token from
+// before keys were hashed is accepted once by equality and then rehashed.
+// Keys found in the cache are not looked up at all.
+func (r *MemeRepository) authenticate(ctx context.Context, authToken string) (client authClient, err error) {
+	defer func() {
+		if err == nil {
+			// Identify the client in the request's access log.
+			logging.Annotate(ctx, slog.Int("client_id", client.clientID))
 		}
-		return 0, err
+	}()
+
+	if authToken == "" {
+		return authClient{}, ErrInvalidAuthToken
+	}
+
+	var ok bool
+	if client, ok = r.cache.lookup(authToken); ok {
+		return client, nil
 	}
-	return tokenBalance, nil
+	ticket := r.cache.startRead()
+	defer func() {
+		if err == nil {
+			r.cache.store(authToken, client, ticket)
+		}
+	}()
+
+	client, err = r.authenticateByPrefix(ctx, authToken)
+	if !errors.Is(err, ErrInvalidAuthToken) || !apikey.IsLegacy(authToken) {
+		return client, err
+	}
+
+	client, err = r.rehashLegacyToken(ctx, authToken)
+	if errors.Is(err, ErrInvalidAuthToken) {
+		// A concurrent request may have rehashed the token first.
+		return r.authenticateByPrefix(ctx, authToken)
+	}
+	return client, err
 }
 
-// AddTokens adds tokens to a client's balance.
-func (r *MemeRepository) AddTokens(authToken string, amount int) error {
-	_, err := r.db.Exec("UPDATE clients SET token_balance = token_balance + $1 WHERE auth_token = $2", amount, authToken)
-	return err
+// authenticateByPrefix looks a key up by its prefix and verifies its secret
+// in constant time.
+func (r *MemeRepository) authenticateByPrefix(ctx context.Context, authToken string) (client authClient, err error) {
+	prefix, secret := apikey.Parse(authToken)
+
+	var salt, hash []byte
+	var disabled bool
+	err = r.db.QueryRowContext(ctx, `SELECT client_id, token_balance, key_salt, key_hash, disabled_at IS NOT NULL,
+		COALESCE(rate_limit_per_minute, 0), COALESCE(rate_limit_burst, 0)
+		FROM clients WHERE key_prefix = $1`, prefix).
+		Scan(&client.clientID, &client.tokenBalance, &salt, &hash, &disabled, &client.requestsPerMinute, &client.burst)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return authClient{}, ErrInvalidAuthToken
+		}
+		return authClient{}, err
+	}
+
+	if !apikey.Verify(salt, hash, secret) {
+		return authClient{}, ErrInvalidAuthToken
+	}
+	if disabled {
+		return authClient{}, ErrClientDisabled
+	}
+	return client, nil
+}
+
+// rehashLegacyToken finds a client by its plaintext token and replaces the
+// plaintext with a salted hash, so the token keeps working without being
+// stored in clear.
+func (r *MemeRepository) rehashLegacyToken(ctx context.Context, authToken string) (client authClient, err error) {
+	key, err := apikey.Rehash(authToken)
+	if err != nil {
+		return authClient{}, err
+	}
+
+	var disabled bool
+	err = r.db.QueryRowContext(ctx, `UPDATE clients SET key_prefix = $1, key_salt = $2, key_hash = $3, auth_token = NULL
+		WHERE auth_token = $4 AND key_hash IS NULL
+		RETURNING client_id, token_balance, disabled_at IS NOT NULL,
+			COALESCE(rate_limit_per_minute, 0), COALESCE(rate_limit_burst, 0)`, key.Prefix, key.Salt, key.Hash, authToken).
+		Scan(&client.clientID, &client.tokenBalance, &disabled, &client.requestsPerMinute, &client.burst)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return authClient{}, ErrInvalidAuthToken
+		}
+		return authClient{}, err
+	}
+	if disabled {
+		return authClient{}, ErrClientDisabled
+	}
+	return client, nil
 }
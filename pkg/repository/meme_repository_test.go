@@ -0,0 +1,146 @@
+package repository_test
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"maas/internal/apikey"
+	"maas/internal/config"
+	"maas/internal/logging"
+	"maas/internal/store"
+	"maas/pkg/repository"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCancelledContextAbortsQuery(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	memeRepo := repository.NewMemeRepository(db, nil, nil)
+
+	t.Run("Deadline Exceeded", func(t *testing.T) {
+		// Set up a lookup that takes far longer than the caller will wait
+		mock.ExpectQuery("SELECT client_id, token_balance, key_salt, key_hash").
+			WillDelayFor(10 * time.Second).
+			WillReturnRows(sqlmock.NewRows([]string{"client_id"}))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		// Call the repository
+		start := time.Now()
+		_, err := memeRepo.GetTokenBalance(ctx, "maas_0123456789ab_secret")
+
+		// Check the query was abandoned at the deadline
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Less(t, time.Since(start), 5*time.Second)
+	})
+
+	t.Run("Cancelled Before Start", func(t *testing.T) {
+		// No query is expected to reach the database
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		// Call the repository
+		_, err := memeRepo.GetMemeCandidates(ctx, nil, 10)
+
+		// Check the result
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+func TestAuthenticatedClientIsAnnotated(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	memeRepo := repository.NewMemeRepository(db, nil, nil)
+	key, err := apikey.Generate()
+	require.NoError(t, err)
+
+	// Set up the client lookup
+	mock.ExpectQuery("SELECT client_id, token_balance, key_salt, key_hash").
+		WithArgs(key.Prefix).
+		WillReturnRows(sqlmock.NewRows([]string{"client_id", "token_balance", "key_salt", "key_hash", "disabled", "rate_limit_per_minute", "rate_limit_burst"}).
+			AddRow(7, 100, key.Salt, key.Hash, false, 0, 0))
+
+	// Call the repository
+	ctx, annotations := logging.WithAnnotations(context.Background())
+	balance, err := memeRepo.GetTokenBalance(ctx, key.Token)
+
+	// Check the client is identified for the access log
+	require.NoError(t, err)
+	assert.Equal(t, 100, balance)
+	assert.Equal(t, []slog.Attr{slog.Int("client_id", 7)}, annotations())
+}
+
+func TestBalanceCacheSavesLookups(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	cache := repository.NewBalanceCache(config.BalanceCacheConfig{Size: 10, TTL: 30})
+	memeRepo := repository.NewMemeRepository(db, cache, nil)
+	key, err := apikey.Generate()
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	// Set up a single client lookup, then the reservation
+	mock.ExpectQuery("SELECT client_id, token_balance, key_salt, key_hash").
+		WithArgs(key.Prefix).
+		WillReturnRows(sqlmock.NewRows([]string{"client_id", "token_balance", "key_salt", "key_hash", "disabled", "rate_limit_per_minute", "rate_limit_burst"}).
+			AddRow(7, 100, key.Salt, key.Hash, false, 0, 0))
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT token_balance FROM clients").WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"token_balance"}).AddRow(100))
+	mock.ExpectQuery("UPDATE clients SET token_balance").WithArgs(-1, 7).
+		WillReturnRows(sqlmock.NewRows([]string{"token_balance"}).AddRow(99))
+	mock.ExpectExec("INSERT INTO token_ledger").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	// Call the repository
+	balance, err := memeRepo.GetTokenBalance(ctx, key.Token)
+	require.NoError(t, err)
+	assert.Equal(t, 100, balance)
+	require.NoError(t, memeRepo.ReserveToken(ctx, key.Token, store.LedgerMeta{}))
+	balance, err = memeRepo.GetTokenBalance(ctx, key.Token)
+
+	// Check the new balance was written through, without another lookup
+	require.NoError(t, err)
+	assert.Equal(t, 99, balance)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRateLimitReadWithClient(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	cache := repository.NewBalanceCache(config.BalanceCacheConfig{Size: 10, TTL: 30})
+	memeRepo := repository.NewMemeRepository(db, cache, nil)
+	key, err := apikey.Generate()
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	// Set up a single client lookup, which carries the client's rate limit
+	mock.ExpectQuery("SELECT client_id, token_balance, key_salt, key_hash").
+		WithArgs(key.Prefix).
+		WillReturnRows(sqlmock.NewRows([]string{"client_id", "token_balance", "key_salt", "key_hash", "disabled", "rate_limit_per_minute", "rate_limit_burst"}).
+			AddRow(7, 100, key.Salt, key.Hash, false, 120, 20))
+
+	// Call the repository, then again once the client is cached
+	for i := 0; i < 2; i++ {
+		limit, err := memeRepo.GetRateLimit(ctx, key.Token)
+
+		// Check the limit needs no query of its own
+		require.NoError(t, err)
+		assert.Equal(t, &store.RateLimit{ClientID: 7, RequestsPerMinute: 120, Burst: 20}, limit)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,28 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"maas/internal/tracing"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// startSpan starts a client span for a database operation. End it with
+// endSpan.
+func startSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	return tracing.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(semconv.DBSystemPostgreSQL))
+}
+
+// endSpan ends a span started with startSpan, recording *err. An error
+// returned once ctx has ended is reported as ctx's error, as drivers report
+// an abandoned query with errors of their own.
+func endSpan(ctx context.Context, span trace.Span, err *error) {
+	if *err != nil && ctx.Err() != nil && !errors.Is(*err, ctx.Err()) {
+		*err = fmt.Errorf("%w: %v", ctx.Err(), *err)
+	}
+	tracing.End(span, *err)
+}
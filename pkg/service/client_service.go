@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"maas/internal/apikey"
+	"maas/internal/store"
+	"maas/internal/tracing"
+	"maas/pkg/repository"
+	"maas/utils"
+)
+
+//go:generate mockgen -source=client_service.go -destination=mock/mock_client_repository.go -package=mock_service
+
+// ErrClientNotFound is returned when no client has the requested ID.
+var ErrClientNotFound = repository.ErrClientNotFound
+
+// ErrClientDisabled is returned when a valid key belongs to a disabled client.
+var ErrClientDisabled = repository.ErrClientDisabled
+
+// actorAdmin identifies balance changes made through the admin API.
+const actorAdmin = "admin"
+
+// Client page size limits.
+const (
+	defaultClientPageSize = 50
+	maxClientPageSize     = 200
+)
+
+// ClientRepository is the data access the client service depends on.
+type ClientRepository interface {
+	CreateClient(ctx context.Context, name string, key apikey.Key, initialTokens int, meta store.LedgerMeta) (*store.ClientSummary, error)
+	ListClients(ctx context.Context, after, limit int) ([]store.ClientSummary, error)
+	GetClient(ctx context.Context, clientID int) (*store.ClientSummary, error)
+	SetClientDisabled(ctx context.Context, clientID int, disabled bool) (*store.ClientSummary, error)
+	RotateClientKey(ctx context.Context, clientID int, key apikey.Key) (*store.ClientSummary, error)
+	ReconcileClient(ctx context.Context, clientID int) (*store.Reconciliation, error)
+}
+
+// ClientService handles the business logic for managing clients.
+type ClientService struct {
+	clientRepo ClientRepository
+}
+
+// NewClientService creates a new ClientService.
+func NewClientService(clientRepo ClientRepository) *ClientService {
+	return &ClientService{
+		clientRepo: clientRepo,
+	}
+}
+
+// CreateClientRequest represents the request body for creating a client.
+type CreateClientRequest struct {
+	Name          string `json:"name"`
+	InitialTokens int    `json:"initial_tokens"`
+}
+
+// CreateClient issues a new client with a fresh API key.
+func (s *ClientService) CreateClient(ctx context.Context, name string, initialTokens int) (_ *store.ClientCredentials, err error) {
+	ctx, span := tracing.Start(ctx, "ClientService.CreateClient")
+	defer func() { tracing.End(span, err) }()
+
+	key, err := apikey.Generate()
+	if err != nil {
+		return nil, err
+	}
+
+	meta := store.LedgerMeta{
+		Reason:      "initial tokens",
+		Actor:       actorAdmin,
+		ReferenceID: utils.NewReferenceID(),
+	}
+	client, err := s.clientRepo.CreateClient(ctx, name, key, initialTokens, meta)
+	if err != nil {
+		return nil, err
+	}
+
+	return &store.ClientCredentials{ClientSummary: *client, APIKey: key.Token}, nil
+}
+
+// ListClients returns a page of clients ordered by ID. cursor is the
+// NextCursor of the previous page, or zero for the first page.
+func (s *ClientService) ListClients(ctx context.Context, cursor, limit int) (_ *store.ClientPage, err error) {
+	ctx, span := tracing.Start(ctx, "ClientService.ListClients")
+	defer func() { tracing.End(span, err) }()
+
+	if limit <= 0 {
+		limit = defaultClientPageSize
+	}
+	if limit > maxClientPageSize {
+		limit = maxClientPageSize
+	}
+
+	// Fetch one extra client to find out whether another page follows.
+	clients, err := s.clientRepo.ListClients(ctx, cursor, limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &store.ClientPage{Clients: clients}
+	if len(clients) > limit {
+		page.Clients = clients[:limit]
+		page.NextCursor = page.Clients[limit-1].ClientID
+	}
+	return page, nil
+}
+
+// GetClient retrieves a client by ID.
+func (s *ClientService) GetClient(ctx context.Context, clientID int) (_ *store.ClientSummary, err error) {
+	ctx, span := tracing.Start(ctx, "ClientService.GetClient")
+	defer func() { tracing.End(span, err) }()
+
+	return s.clientRepo.GetClient(ctx, clientID)
+}
+
+// DisableClient stops a client's key from being accepted.
+func (s *ClientService) DisableClient(ctx context.Context, clientID int) (_ *store.ClientSummary, err error) {
+	ctx, span := tracing.Start(ctx, "ClientService.DisableClient")
+	defer func() { tracing.End(span, err) }()
+
+	return s.clientRepo.SetClientDisabled(ctx, clientID, true)
+}
+
+// EnableClient re-enables a disabled client.
+func (s *ClientService) EnableClient(ctx context.Context, clientID int) (_ *store.ClientSummary, err error) {
+	ctx, span := tracing.Start(ctx, "ClientService.EnableClient")
+	defer func() { tracing.End(span, err) }()
+
+	return s.clientRepo.SetClientDisabled(ctx, clientID, false)
+}
+
+// RotateKey issues a new API key for a client, revoking the old one.
+func (s *ClientService) RotateKey(ctx context.Context, clientID int) (_ *store.ClientCredentials, err error) {
+	ctx, span := tracing.Start(ctx, "ClientService.RotateKey")
+	defer func() { tracing.End(span, err) }()
+
+	key, err := apikey.Generate()
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := s.clientRepo.RotateClientKey(ctx, clientID, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &store.ClientCredentials{ClientSummary: *client, APIKey: key.Token}, nil
+}
+
+// ReconcileClient checks a client's balance against its ledger.
+func (s *ClientService) ReconcileClient(ctx context.Context, clientID int) (_ *store.Reconciliation, err error) {
+	ctx, span := tracing.Start(ctx, "ClientService.ReconcileClient")
+	defer func() { tracing.End(span, err) }()
+
+	return s.clientRepo.ReconcileClient(ctx, clientID)
+}
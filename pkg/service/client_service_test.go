@@ -0,0 +1,102 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+
+	"maas/internal/apikey"
+	"maas/internal/store"
+	"maas/pkg/service"
+	mock_service "maas/pkg/service/mock"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateClient(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClientRepo := mock_service.NewMockClientRepository(ctrl)
+	clientService := service.NewClientService(mockClientRepo)
+
+	// Set up expectations for the mock repository, capturing the issued key
+	var issued apikey.Key
+	mockClientRepo.EXPECT().
+		CreateClient(gomock.Any(), "Acme", gomock.Any(), 100, gomock.Any()).
+		DoAndReturn(func(_ context.Context, name string, key apikey.Key, initialTokens int, meta store.LedgerMeta) (*store.ClientSummary, error) {
+			assert.Equal(t, "admin", meta.Actor)
+			issued = key
+			return &store.ClientSummary{ClientID: 7, Name: name, KeyPrefix: key.Prefix, TokenBalance: initialTokens}, nil
+		})
+
+	// Call the service
+	creds, err := clientService.CreateClient(context.Background(), "Acme", 100)
+
+	// Check the result; the plaintext key is returned but only its hash is stored
+	require.NoError(t, err)
+	assert.Equal(t, issued.Token, creds.APIKey)
+	prefix, secret := apikey.Parse(creds.APIKey)
+	assert.Equal(t, creds.KeyPrefix, prefix)
+	assert.True(t, apikey.Verify(issued.Salt, issued.Hash, secret))
+}
+
+func TestRotateKey(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClientRepo := mock_service.NewMockClientRepository(ctrl)
+	clientService := service.NewClientService(mockClientRepo)
+
+	t.Run("Successful Request", func(t *testing.T) {
+		// Set up expectations for the mock repository
+		mockClientRepo.EXPECT().
+			RotateClientKey(gomock.Any(), 7, gomock.Any()).
+			DoAndReturn(func(_ context.Context, clientID int, key apikey.Key) (*store.ClientSummary, error) {
+				return &store.ClientSummary{ClientID: clientID, KeyPrefix: key.Prefix}, nil
+			})
+
+		// Call the service
+		creds, err := clientService.RotateKey(context.Background(), 7)
+
+		// Check the result
+		require.NoError(t, err)
+		assert.Contains(t, creds.APIKey, creds.KeyPrefix)
+	})
+
+	t.Run("Client Not Found", func(t *testing.T) {
+		// Set up expectations for the mock repository
+		mockClientRepo.EXPECT().
+			RotateClientKey(gomock.Any(), 8, gomock.Any()).
+			Return(nil, service.ErrClientNotFound)
+
+		// Call the service
+		creds, err := clientService.RotateKey(context.Background(), 8)
+
+		// Check the result
+		assert.Nil(t, creds)
+		assert.Equal(t, service.ErrClientNotFound, err)
+	})
+}
+
+func TestListClients(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClientRepo := mock_service.NewMockClientRepository(ctrl)
+	clientService := service.NewClientService(mockClientRepo)
+
+	// Set up expectations for the mock repository to return one extra client
+	mockClientRepo.EXPECT().
+		ListClients(gomock.Any(), 0, 3).
+		Return([]store.ClientSummary{{ClientID: 1}, {ClientID: 2}, {ClientID: 3}}, nil)
+
+	// Call the service
+	page, err := clientService.ListClients(context.Background(), 0, 2)
+
+	// Check the result
+	require.NoError(t, err)
+	assert.Len(t, page.Clients, 2)
+	assert.Equal(t, 2, page.NextCursor)
+}
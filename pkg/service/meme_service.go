@@ -1,65 +1,208 @@
 package service
 
 import (
-	"errors"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"strconv"
+	"time"
 
+	"maas/internal/apikey"
+	"maas/internal/config"
+	"maas/internal/geo"
 	"maas/internal/store"
+	"maas/internal/tracing"
 	"maas/pkg/repository"
 	"maas/utils"
+
+	"go.opentelemetry.io/otel/trace"
 )
 
+//go:generate mockgen -source=meme_service.go -destination=mock/mock_meme_repository.go -package=mock_service
+
+// MemeRepository is the data access the service depends on.
+type MemeRepository interface {
+	ReserveToken(ctx context.Context, authToken string, meta store.LedgerMeta) error
+	RefundToken(ctx context.Context, authToken string, meta store.LedgerMeta) error
+	AddTokens(ctx context.Context, authToken string, amount int, meta store.LedgerMeta) error
+	AddTokensOnce(ctx context.Context, authToken string, amount int, meta store.LedgerMeta, rec store.IdempotencyRecord, ttl time.Duration) (*store.IdempotencyRecord, error)
+	LogAPICall(ctx context.Context, authToken string) error
+	GetTokenBalance(ctx context.Context, authToken string) (int, error)
+	GetRateLimit(ctx context.Context, authToken string) (*store.RateLimit, error)
+	ListLedgerEntries(ctx context.Context, authToken string, before int64, limit int) ([]store.LedgerEntry, error)
+	GetMemeCandidates(ctx context.Context, location *geo.Point, limit int) ([]store.Meme, error)
+	SearchMemes(ctx context.Context, query string, location *geo.Point, limit int) ([]store.Meme, error)
+}
+
 // MemeService handles the business logic for memes.
 type MemeService struct {
-	memeRepo *repository.MemeRepository
+	memeRepo       MemeRepository
+	idempotencyTTL time.Duration
 }
 
 // NewMemeService creates a new MemeService.
-func NewMemeService(memeRepo *repository.MemeRepository) *MemeService {
+func NewMemeService(memeRepo MemeRepository, cfg config.TokensConfig) *MemeService {
 	return &MemeService{
-		memeRepo: memeRepo,
+		memeRepo:       memeRepo,
+		idempotencyTTL: time.Duration(cfg.IdempotencyTTL) * time.Second,
 	}
 }
 
 // ErrInsufficientTokens is returned when a client has insufficient tokens.
-var ErrInsufficientTokens = errors.New("insufficient tokens")
+var ErrInsufficientTokens = repository.ErrInsufficientTokens
 
 // ErrInvalidAuthToken is returned when the provided auth token is invalid.
-var ErrInvalidAuthToken = errors.New("invalid authorization token")
+var ErrInvalidAuthToken = repository.ErrInvalidAuthToken
+
+// ErrIdempotencyKeyReused is returned when an idempotency key is retried with
+// a different request body.
+var ErrIdempotencyKeyReused = repository.ErrIdempotencyKeyReused
+
+// actorClient identifies balance changes made by a client through the API.
+const actorClient = "client"
+
+// refundTimeout bounds the refund of a reserved token, which runs detached
+// from the request that reserved it.
+const refundTimeout = 5 * time.Second
+
+// Number of memes a random pick is made from.
+const (
+	memeCandidateLimit = 20 // Random catalog entries, when nothing matches
+	memeMatchLimit     = 5  // Top-ranked full-text matches
+)
+
+// Ledger page size limits.
+const (
+	defaultLedgerPageSize = 50
+	maxLedgerPageSize     = 200
+)
+
+// MemeRequest represents a validated request for a meme.
+type MemeRequest struct {
+	Location *geo.Point // Nil when the client gave no location
+	Query    string
+}
+
+// GetMeme fetches a meme, charging the client one token for it.
+func (s *MemeService) GetMeme(ctx context.Context, req MemeRequest, authToken string) (_ *store.MemeResponse, err error) {
+	ctx, span := tracing.Start(ctx, "MemeService.GetMeme")
+	defer func() { tracing.End(span, err) }()
 
-// GetMeme fetches a meme, checks token balance, and updates it.
-func (s *MemeService) GetMeme(latitude, longitude, query, authToken string) (*store.MemeResponse, error) {
-	// Check if the client has enough tokens.
-	if err := s.CheckTokenBalance(authToken); err != nil {
+	// Reserve a token for the API call. The check and the deduction happen
+	// in a single transaction so concurrent calls cannot overdraw the balance.
+	meta := store.LedgerMeta{
+		Reason:      "meme request",
+		Actor:       actorClient,
+		ReferenceID: utils.NewReferenceID(),
+	}
+	if err := s.memeRepo.ReserveToken(ctx, authToken, meta); err != nil {
 		return nil, err
 	}
 
-	// Deduct token for the API call.
-	if err := s.memeRepo.DeductToken(authToken); err != nil {
+	// Pick a meme, giving the token back if none could be served.
+	meme, err := s.selectMeme(ctx, req.Query, req.Location)
+	if err != nil {
+		// Refund even when the request was cancelled, or the token is lost.
+		// The refund still belongs to the request's trace.
+		refundCtx, cancel := context.WithTimeout(trace.ContextWithSpan(context.Background(), span), refundTimeout)
+		defer cancel()
+		meta.Reason = "meme selection failed"
+		if rerr := s.memeRepo.RefundToken(refundCtx, authToken, meta); rerr != nil {
+			// The client has paid for nothing; leave a trail to credit them by.
+			prefix, _ := apikey.Parse(authToken)
+			slog.ErrorContext(ctx, "Failed to refund token", "key_prefix", prefix, "reference_id", meta.ReferenceID, "error", rerr)
+			return nil, fmt.Errorf("%w (refunding token: %v)", err, rerr)
+		}
 		return nil, err
 	}
 
 	// Log the API call.
-	if err := s.memeRepo.LogAPICall(authToken); err != nil {
+	if err := s.memeRepo.LogAPICall(ctx, authToken); err != nil {
 		// Log the error, but don't fail the request.
+		slog.WarnContext(ctx, "Failed to log API call", "error", err)
 	}
 
-	// Generate a random meme using the utility function.
-	memeText := utils.GenerateRandomMeme(query)
-
-	// Create a MemeResponse object.
-	meme := &store.MemeResponse{
-		Meme:      memeText,
-		Latitude:  latitude,
-		Longitude: longitude,
-		Query:     query,
+	if req.Location != nil {
+		meme.Latitude = strconv.FormatFloat(req.Location.Latitude, 'f', -1, 64)
+		meme.Longitude = strconv.FormatFloat(req.Location.Longitude, 'f', -1, 64)
 	}
+	meme.Query = req.Query
 
 	return meme, nil
 }
 
+// selectMeme picks a meme for query and location. When query is set, the
+// meme is chosen at random from the best full-text matches; otherwise, or
+// when nothing matches, it is chosen at random from the whole catalog. Memes
+// scoped to the caller's location are preferred over global ones, and those
+// over memes scoped elsewhere. While the catalog is empty it falls back to
+// the placeholder generator.
+func (s *MemeService) selectMeme(ctx context.Context, query string, location *geo.Point) (*store.MemeResponse, error) {
+	if query != "" {
+		matches, err := s.memeRepo.SearchMemes(ctx, query, location, memeMatchLimit)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) > 0 {
+			meme := newMemeResponse(pickMeme(matches))
+			meme.Matched = true
+			return meme, nil
+		}
+	}
+
+	candidates, err := s.memeRepo.GetMemeCandidates(ctx, location, memeCandidateLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(candidates) == 0 {
+		return &store.MemeResponse{Meme: utils.GenerateRandomMeme(query)}, nil
+	}
+
+	return newMemeResponse(pickMeme(candidates)), nil
+}
+
+// pickMeme picks at random among the leading memes that share the best
+// scope rank. memes must be ordered by scope rank and must not be empty.
+func pickMeme(memes []store.Meme) store.Meme {
+	n := 1
+	for n < len(memes) && memes[n].ScopeRank == memes[0].ScopeRank {
+		n++
+	}
+	return memes[rand.Intn(n)]
+}
+
+// newMemeResponse builds the response for a catalog meme.
+func newMemeResponse(m store.Meme) *store.MemeResponse {
+	return &store.MemeResponse{
+		ID:       m.MemeID,
+		Meme:     m.Text,
+		ImageURL: m.ImageURL,
+		Tags:     m.Tags,
+		Language: m.Language,
+		Local:    m.ScopeRank == store.ScopeLocal,
+	}
+}
+
+// Authenticate checks that the auth token belongs to a client.
+func (s *MemeService) Authenticate(ctx context.Context, authToken string) (err error) {
+	ctx, span := tracing.Start(ctx, "MemeService.Authenticate")
+	defer func() { tracing.End(span, err) }()
+
+	_, err = s.memeRepo.GetTokenBalance(ctx, authToken)
+	return err
+}
+
 // CheckTokenBalance checks if the client has a sufficient token balance.
-func (s *MemeService) CheckTokenBalance(authToken string) error {
-	tokenBalance, err := s.memeRepo.GetTokenBalance(authToken)
+func (s *MemeService) CheckTokenBalance(ctx context.Context, authToken string) (err error) {
+	ctx, span := tracing.Start(ctx, "MemeService.CheckTokenBalance")
+	defer func() { tracing.End(span, err) }()
+
+	tokenBalance, err := s.memeRepo.GetTokenBalance(ctx, authToken)
 	if err != nil {
 		return err
 	}
@@ -77,11 +220,80 @@ type AddTokensRequest struct {
 }
 
 // AddTokens adds tokens to a client's balance.
-func (s *MemeService) AddTokens(authToken string, amount int) error {
-	return s.memeRepo.AddTokens(authToken, amount)
+func (s *MemeService) AddTokens(ctx context.Context, authToken string, amount int) (err error) {
+	ctx, span := tracing.Start(ctx, "MemeService.AddTokens")
+	defer func() { tracing.End(span, err) }()
+
+	meta := store.LedgerMeta{
+		Reason:      "token purchase",
+		Actor:       actorClient,
+		ReferenceID: utils.NewReferenceID(),
+	}
+	return s.memeRepo.AddTokens(ctx, authToken, amount, meta)
+}
+
+// AddTokensIdempotent adds tokens to a client's balance at most once per
+// idempotency key. rec carries the key and the response to remember if the
+// tokens are credited; the returned record is either rec or, for a retry of
+// an earlier request, the response stored the first time.
+func (s *MemeService) AddTokensIdempotent(ctx context.Context, authToken string, amount int, rec store.IdempotencyRecord) (_ *store.IdempotencyRecord, err error) {
+	ctx, span := tracing.Start(ctx, "MemeService.AddTokensIdempotent")
+	defer func() { tracing.End(span, err) }()
+
+	body, err := json.Marshal(AddTokensRequest{Amount: amount})
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(body)
+	rec.RequestHash = hex.EncodeToString(sum[:])
+
+	meta := store.LedgerMeta{
+		Reason:      "token purchase",
+		Actor:       actorClient,
+		ReferenceID: rec.Key,
+	}
+	return s.memeRepo.AddTokensOnce(ctx, authToken, amount, meta, rec, s.idempotencyTTL)
 }
 
 // GetTokenBalance retrieves the token balance for a client.
-func (s *MemeService) GetTokenBalance(authToken string) (int, error) {
-	return s.memeRepo.GetTokenBalance(authToken)
+func (s *MemeService) GetTokenBalance(ctx context.Context, authToken string) (_ int, err error) {
+	ctx, span := tracing.Start(ctx, "MemeService.GetTokenBalance")
+	defer func() { tracing.End(span, err) }()
+
+	return s.memeRepo.GetTokenBalance(ctx, authToken)
+}
+
+// GetRateLimit retrieves the client's own request rate limit.
+func (s *MemeService) GetRateLimit(ctx context.Context, authToken string) (_ *store.RateLimit, err error) {
+	ctx, span := tracing.Start(ctx, "MemeService.GetRateLimit")
+	defer func() { tracing.End(span, err) }()
+
+	return s.memeRepo.GetRateLimit(ctx, authToken)
+}
+
+// GetLedger returns a page of the client's ledger entries, newest first.
+// cursor is the NextCursor of the previous page, or zero for the first page.
+func (s *MemeService) GetLedger(ctx context.Context, authToken string, cursor int64, limit int) (_ *store.LedgerPage, err error) {
+	ctx, span := tracing.Start(ctx, "MemeService.GetLedger")
+	defer func() { tracing.End(span, err) }()
+
+	if limit <= 0 {
+		limit = defaultLedgerPageSize
+	}
+	if limit > maxLedgerPageSize {
+		limit = maxLedgerPageSize
+	}
+
+	// Fetch one extra entry to find out whether another page follows.
+	entries, err := s.memeRepo.ListLedgerEntries(ctx, authToken, cursor, limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &store.LedgerPage{Entries: entries}
+	if len(entries) > limit {
+		page.Entries = entries[:limit]
+		page.NextCursor = page.Entries[limit-1].EntryID
+	}
+	return page, nil
 }
@@ -0,0 +1,288 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"maas/internal/config"
+	"maas/internal/geo"
+	"maas/internal/store"
+	"maas/pkg/service"
+	mock_service "maas/pkg/service/mock"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetMeme(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMemeRepo := mock_service.NewMockMemeRepository(ctrl)
+	memeService := service.NewMemeService(mockMemeRepo, config.TokensConfig{})
+
+	t.Run("Successful Request", func(t *testing.T) {
+		// Set up expectations for the mock repository
+		mockMemeRepo.EXPECT().
+			ReserveToken(gomock.Any(), "test_token", gomock.Any()).
+			DoAndReturn(func(_ context.Context, authToken string, meta store.LedgerMeta) error {
+				assert.Equal(t, "client", meta.Actor)
+				assert.NotEmpty(t, meta.ReferenceID)
+				return nil
+			})
+		mockMemeRepo.EXPECT().
+			SearchMemes(gomock.Any(), "food", &geo.Point{Latitude: 40.7, Longitude: -73.9}, gomock.Any()).
+			Return([]store.Meme{{MemeID: 7, Text: "Catalog meme", Tags: []string{"food"}, Language: "en"}}, nil)
+		mockMemeRepo.EXPECT().
+			LogAPICall(gomock.Any(), "test_token").
+			Return(errors.New("some error"))
+
+		// Call the service
+		meme, err := memeService.GetMeme(context.Background(), service.MemeRequest{Location: &geo.Point{Latitude: 40.7, Longitude: -73.9}, Query: "food"}, "test_token")
+
+		// Check the result; a logging failure must not fail the request
+		assert.NoError(t, err)
+		assert.Equal(t, 7, meme.ID)
+		assert.Equal(t, "Catalog meme", meme.Meme)
+		assert.Equal(t, []string{"food"}, meme.Tags)
+		assert.True(t, meme.Matched)
+		assert.Equal(t, "food", meme.Query)
+	})
+
+	t.Run("Prefers Local Memes", func(t *testing.T) {
+		// Set up expectations for the mock repository
+		mockMemeRepo.EXPECT().ReserveToken(gomock.Any(), "test_token", gomock.Any()).Return(nil)
+		mockMemeRepo.EXPECT().
+			GetMemeCandidates(gomock.Any(), &geo.Point{Latitude: 48.85, Longitude: 2.35}, gomock.Any()).
+			Return([]store.Meme{
+				{MemeID: 1, Text: "Local meme", ScopeRank: store.ScopeLocal},
+				{MemeID: 2, Text: "Global meme", ScopeRank: store.ScopeGlobal},
+				{MemeID: 3, Text: "Global meme", ScopeRank: store.ScopeGlobal},
+			}, nil)
+		mockMemeRepo.EXPECT().LogAPICall(gomock.Any(), "test_token").Return(nil)
+
+		// Call the service
+		meme, err := memeService.GetMeme(context.Background(), service.MemeRequest{Location: &geo.Point{Latitude: 48.85, Longitude: 2.35}}, "test_token")
+
+		// Check the result
+		assert.NoError(t, err)
+		assert.Equal(t, 1, meme.ID)
+		assert.True(t, meme.Local)
+	})
+
+	t.Run("No Match Falls Back", func(t *testing.T) {
+		// Set up expectations for the mock repository
+		mockMemeRepo.EXPECT().ReserveToken(gomock.Any(), "test_token", gomock.Any()).Return(nil)
+		mockMemeRepo.EXPECT().SearchMemes(gomock.Any(), "zebras", gomock.Any(), gomock.Any()).Return([]store.Meme{}, nil)
+		mockMemeRepo.EXPECT().
+			GetMemeCandidates(gomock.Any(), gomock.Any(), gomock.Any()).
+			Return([]store.Meme{{MemeID: 3, Text: "Random meme"}}, nil)
+		mockMemeRepo.EXPECT().LogAPICall(gomock.Any(), "test_token").Return(nil)
+
+		// Call the service
+		meme, err := memeService.GetMeme(context.Background(), service.MemeRequest{Query: "zebras"}, "test_token")
+
+		// Check the result
+		assert.NoError(t, err)
+		assert.Equal(t, 3, meme.ID)
+		assert.False(t, meme.Matched)
+	})
+
+	t.Run("No Query Skips Search", func(t *testing.T) {
+		// Set up expectations for the mock repository; SearchMemes must not be called
+		mockMemeRepo.EXPECT().ReserveToken(gomock.Any(), "test_token", gomock.Any()).Return(nil)
+		mockMemeRepo.EXPECT().
+			GetMemeCandidates(gomock.Any(), gomock.Any(), gomock.Any()).
+			Return([]store.Meme{{MemeID: 3, Text: "Random meme"}}, nil)
+		mockMemeRepo.EXPECT().LogAPICall(gomock.Any(), "test_token").Return(nil)
+
+		// Call the service
+		meme, err := memeService.GetMeme(context.Background(), service.MemeRequest{}, "test_token")
+
+		// Check the result
+		assert.NoError(t, err)
+		assert.Equal(t, 3, meme.ID)
+		assert.False(t, meme.Matched)
+	})
+
+	t.Run("Empty Catalog", func(t *testing.T) {
+		// Set up expectations for the mock repository
+		mockMemeRepo.EXPECT().ReserveToken(gomock.Any(), "test_token", gomock.Any()).Return(nil)
+		mockMemeRepo.EXPECT().SearchMemes(gomock.Any(), "cats", gomock.Any(), gomock.Any()).Return([]store.Meme{}, nil)
+		mockMemeRepo.EXPECT().GetMemeCandidates(gomock.Any(), gomock.Any(), gomock.Any()).Return([]store.Meme{}, nil)
+		mockMemeRepo.EXPECT().LogAPICall(gomock.Any(), "test_token").Return(nil)
+
+		// Call the service
+		meme, err := memeService.GetMeme(context.Background(), service.MemeRequest{Query: "cats"}, "test_token")
+
+		// Check the result falls back to the placeholder meme
+		assert.NoError(t, err)
+		assert.Zero(t, meme.ID)
+		assert.NotEmpty(t, meme.Meme)
+	})
+
+	t.Run("Catalog Error Refunds Token", func(t *testing.T) {
+		// Set up expectations for the mock repository
+		var reserved store.LedgerMeta
+		mockMemeRepo.EXPECT().
+			ReserveToken(gomock.Any(), "test_token", gomock.Any()).
+			DoAndReturn(func(_ context.Context, authToken string, meta store.LedgerMeta) error {
+				reserved = meta
+				return nil
+			})
+		mockMemeRepo.EXPECT().
+			GetMemeCandidates(gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(nil, errors.New("db down"))
+		mockMemeRepo.EXPECT().
+			RefundToken(gomock.Any(), "test_token", gomock.Any()).
+			DoAndReturn(func(_ context.Context, authToken string, meta store.LedgerMeta) error {
+				assert.Equal(t, reserved.ReferenceID, meta.ReferenceID)
+				return nil
+			})
+
+		// Call the service
+		meme, err := memeService.GetMeme(context.Background(), service.MemeRequest{}, "test_token")
+
+		// Check the result
+		assert.Nil(t, meme)
+		assert.EqualError(t, err, "db down")
+	})
+
+	t.Run("Failed Refund Is Reported", func(t *testing.T) {
+		// Set up expectations for the mock repository
+		mockMemeRepo.EXPECT().ReserveToken(gomock.Any(), "test_token", gomock.Any()).Return(nil)
+		mockMemeRepo.EXPECT().
+			GetMemeCandidates(gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(nil, errors.New("db down"))
+		mockMemeRepo.EXPECT().
+			RefundToken(gomock.Any(), "test_token", gomock.Any()).
+			Return(errors.New("connection reset"))
+
+		// Call the service
+		meme, err := memeService.GetMeme(context.Background(), service.MemeRequest{}, "test_token")
+
+		// Check both failures are reported
+		assert.Nil(t, meme)
+		assert.EqualError(t, err, "db down (refunding token: connection reset)")
+	})
+
+	t.Run("Refund Survives Cancelled Request", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		// Set up expectations for the mock repository; the client goes away
+		// while the catalog is queried
+		mockMemeRepo.EXPECT().ReserveToken(gomock.Any(), "test_token", gomock.Any()).Return(nil)
+		mockMemeRepo.EXPECT().
+			GetMemeCandidates(gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(ctx context.Context, location *geo.Point, limit int) ([]store.Meme, error) {
+				cancel()
+				return nil, ctx.Err()
+			})
+		mockMemeRepo.EXPECT().
+			RefundToken(gomock.Any(), "test_token", gomock.Any()).
+			DoAndReturn(func(ctx context.Context, authToken string, meta store.LedgerMeta) error {
+				assert.NoError(t, ctx.Err())
+				return nil
+			})
+
+		// Call the service
+		_, err := memeService.GetMeme(ctx, service.MemeRequest{}, "test_token")
+
+		// Check the result
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("Insufficient Tokens", func(t *testing.T) {
+		// Set up expectations for the mock repository
+		mockMemeRepo.EXPECT().
+			ReserveToken(gomock.Any(), "test_token", gomock.Any()).
+			Return(service.ErrInsufficientTokens)
+
+		// Call the service
+		meme, err := memeService.GetMeme(context.Background(), service.MemeRequest{}, "test_token")
+
+		// Check the result
+		assert.Nil(t, meme)
+		assert.Equal(t, service.ErrInsufficientTokens, err)
+	})
+}
+
+func TestGetLedger(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMemeRepo := mock_service.NewMockMemeRepository(ctrl)
+	memeService := service.NewMemeService(mockMemeRepo, config.TokensConfig{})
+
+	t.Run("More Pages", func(t *testing.T) {
+		// Set up expectations for the mock repository to return one extra entry
+		mockMemeRepo.EXPECT().
+			ListLedgerEntries(gomock.Any(), "test_token", int64(0), 3).
+			Return([]store.LedgerEntry{{EntryID: 9}, {EntryID: 8}, {EntryID: 7}}, nil)
+
+		// Call the service
+		page, err := memeService.GetLedger(context.Background(), "test_token", 0, 2)
+
+		// Check the result
+		assert.NoError(t, err)
+		assert.Len(t, page.Entries, 2)
+		assert.Equal(t, int64(8), page.NextCursor)
+	})
+
+	t.Run("Last Page", func(t *testing.T) {
+		// Set up expectations for the mock repository
+		mockMemeRepo.EXPECT().
+			ListLedgerEntries(gomock.Any(), "test_token", int64(8), 3).
+			Return([]store.LedgerEntry{{EntryID: 7}}, nil)
+
+		// Call the service
+		page, err := memeService.GetLedger(context.Background(), "test_token", 8, 2)
+
+		// Check the result
+		assert.NoError(t, err)
+		assert.Len(t, page.Entries, 1)
+		assert.Zero(t, page.NextCursor)
+	})
+
+	t.Run("Default Limit", func(t *testing.T) {
+		// Set up expectations for the mock repository
+		mockMemeRepo.EXPECT().
+			ListLedgerEntries(gomock.Any(), "test_token", int64(0), 51).
+			Return([]store.LedgerEntry{}, nil)
+
+		// Call the service
+		_, err := memeService.GetLedger(context.Background(), "test_token", 0, 0)
+
+		// Check the result
+		assert.NoError(t, err)
+	})
+}
+
+func TestAddTokensIdempotent(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMemeRepo := mock_service.NewMockMemeRepository(ctrl)
+	memeService := service.NewMemeService(mockMemeRepo, config.TokensConfig{IdempotencyTTL: 60})
+
+	// The same amount must always hash to the same request fingerprint
+	var hashes []string
+	mockMemeRepo.EXPECT().
+		AddTokensOnce(gomock.Any(), "test_token", 100, gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, authToken string, amount int, meta store.LedgerMeta, rec store.IdempotencyRecord, ttl time.Duration) (*store.IdempotencyRecord, error) {
+			assert.Equal(t, "payment-1", meta.ReferenceID)
+			hashes = append(hashes, rec.RequestHash)
+			return &rec, nil
+		}).
+		Times(2)
+
+	for i := 0; i < 2; i++ {
+		_, err := memeService.AddTokensIdempotent(context.Background(), "test_token", 100, store.IdempotencyRecord{Key: "payment-1"})
+		assert.NoError(t, err)
+	}
+	assert.Len(t, hashes, 2)
+	assert.NotEmpty(t, hashes[0])
+	assert.Equal(t, hashes[0], hashes[1])
+}
@@ -0,0 +1,127 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: client_service.go
+
+// Package mock_service is a generated GoMock package.
+package mock_service
+
+import (
+	context "context"
+	apikey "maas/internal/apikey"
+	store "maas/internal/store"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockClientRepository is a mock of ClientRepository interface.
+type MockClientRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockClientRepositoryMockRecorder
+}
+
+// MockClientRepositoryMockRecorder is the mock recorder for MockClientRepository.
+type MockClientRepositoryMockRecorder struct {
+	mock *MockClientRepository
+}
+
+// NewMockClientRepository creates a new mock instance.
+func NewMockClientRepository(ctrl *gomock.Controller) *MockClientRepository {
+	mock := &MockClientRepository{ctrl: ctrl}
+	mock.recorder = &MockClientRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockClientRepository) EXPECT() *MockClientRepositoryMockRecorder {
+	return m.recorder
+}
+
+// CreateClient mocks base method.
+func (m *MockClientRepository) CreateClient(ctx context.Context, name string, key apikey.Key, initialTokens int, meta store.LedgerMeta) (*store.ClientSummary, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateClient", ctx, name, key, initialTokens, meta)
+	ret0, _ := ret[0].(*store.ClientSummary)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateClient indicates an expected call of CreateClient.
+func (mr *MockClientRepositoryMockRecorder) CreateClient(ctx, name, key, initialTokens, meta interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateClient", reflect.TypeOf((*MockClientRepository)(nil).CreateClient), ctx, name, key, initialTokens, meta)
+}
+
+// GetClient mocks base method.
+func (m *MockClientRepository) GetClient(ctx context.Context, clientID int) (*store.ClientSummary, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetClient", ctx, clientID)
+	ret0, _ := ret[0].(*store.ClientSummary)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetClient indicates an expected call of GetClient.
+func (mr *MockClientRepositoryMockRecorder) GetClient(ctx, clientID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetClient", reflect.TypeOf((*MockClientRepository)(nil).GetClient), ctx, clientID)
+}
+
+// ListClients mocks base method.
+func (m *MockClientRepository) ListClients(ctx context.Context, after, limit int) ([]store.ClientSummary, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListClients", ctx, after, limit)
+	ret0, _ := ret[0].([]store.ClientSummary)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListClients indicates an expected call of ListClients.
+func (mr *MockClientRepositoryMockRecorder) ListClients(ctx, after, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListClients", reflect.TypeOf((*MockClientRepository)(nil).ListClients), ctx, after, limit)
+}
+
+// ReconcileClient mocks base method.
+func (m *MockClientRepository) ReconcileClient(ctx context.Context, clientID int) (*store.Reconciliation, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReconcileClient", ctx, clientID)
+	ret0, _ := ret[0].(*store.Reconciliation)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReconcileClient indicates an expected call of ReconcileClient.
+func (mr *MockClientRepositoryMockRecorder) ReconcileClient(ctx, clientID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReconcileClient", reflect.TypeOf((*MockClientRepository)(nil).ReconcileClient), ctx, clientID)
+}
+
+// RotateClientKey mocks base method.
+func (m *MockClientRepository) RotateClientKey(ctx context.Context, clientID int, key apikey.Key) (*store.ClientSummary, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RotateClientKey", ctx, clientID, key)
+	ret0, _ := ret[0].(*store.ClientSummary)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RotateClientKey indicates an expected call of RotateClientKey.
+func (mr *MockClientRepositoryMockRecorder) RotateClientKey(ctx, clientID, key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RotateClientKey", reflect.TypeOf((*MockClientRepository)(nil).RotateClientKey), ctx, clientID, key)
+}
+
+// SetClientDisabled mocks base method.
+func (m *MockClientRepository) SetClientDisabled(ctx context.Context, clientID int, disabled bool) (*store.ClientSummary, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetClientDisabled", ctx, clientID, disabled)
+	ret0, _ := ret[0].(*store.ClientSummary)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SetClientDisabled indicates an expected call of SetClientDisabled.
+func (mr *MockClientRepositoryMockRecorder) SetClientDisabled(ctx, clientID, disabled interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetClientDisabled", reflect.TypeOf((*MockClientRepository)(nil).SetClientDisabled), ctx, clientID, disabled)
+}
@@ -0,0 +1,184 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: meme_service.go
+
+// Package mock_service is a generated GoMock package.
+package mock_service
+
+import (
+	context "context"
+	geo "maas/internal/geo"
+	store "maas/internal/store"
+	reflect "reflect"
+	time "time"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockMemeRepository is a mock of MemeRepository interface.
+type MockMemeRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockMemeRepositoryMockRecorder
+}
+
+// MockMemeRepositoryMockRecorder is the mock recorder for MockMemeRepository.
+type MockMemeRepositoryMockRecorder struct {
+	mock *MockMemeRepository
+}
+
+// NewMockMemeRepository creates a new mock instance.
+func NewMockMemeRepository(ctrl *gomock.Controller) *MockMemeRepository {
+	mock := &MockMemeRepository{ctrl: ctrl}
+	mock.recorder = &MockMemeRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockMemeRepository) EXPECT() *MockMemeRepositoryMockRecorder {
+	return m.recorder
+}
+
+// AddTokens mocks base method.
+func (m *MockMemeRepository) AddTokens(ctx context.Context, authToken string, amount int, meta store.LedgerMeta) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddTokens", ctx, authToken, amount, meta)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddTokens indicates an expected call of AddTokens.
+func (mr *MockMemeRepositoryMockRecorder) AddTokens(ctx, authToken, amount, meta interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddTokens", reflect.TypeOf((*MockMemeRepository)(nil).AddTokens), ctx, authToken, amount, meta)
+}
+
+// AddTokensOnce mocks base method.
+func (m *MockMemeRepository) AddTokensOnce(ctx context.Context, authToken string, amount int, meta store.LedgerMeta, rec store.IdempotencyRecord, ttl time.Duration) (*store.IdempotencyRecord, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddTokensOnce", ctx, authToken, amount, meta, rec, ttl)
+	ret0, _ := ret[0].(*store.IdempotencyRecord)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AddTokensOnce indicates an expected call of AddTokensOnce.
+func (mr *MockMemeRepositoryMockRecorder) AddTokensOnce(ctx, authToken, amount, meta, rec, ttl interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddTokensOnce", reflect.TypeOf((*MockMemeRepository)(nil).AddTokensOnce), ctx, authToken, amount, meta, rec, ttl)
+}
+
+// GetMemeCandidates mocks base method.
+func (m *MockMemeRepository) GetMemeCandidates(ctx context.Context, location *geo.Point, limit int) ([]store.Meme, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetMemeCandidates", ctx, location, limit)
+	ret0, _ := ret[0].([]store.Meme)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetMemeCandidates indicates an expected call of GetMemeCandidates.
+func (mr *MockMemeRepositoryMockRecorder) GetMemeCandidates(ctx, location, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMemeCandidates", reflect.TypeOf((*MockMemeRepository)(nil).GetMemeCandidates), ctx, location, limit)
+}
+
+// GetRateLimit mocks base method.
+func (m *MockMemeRepository) GetRateLimit(ctx context.Context, authToken string) (*store.RateLimit, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRateLimit", ctx, authToken)
+	ret0, _ := ret[0].(*store.RateLimit)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRateLimit indicates an expected call of GetRateLimit.
+func (mr *MockMemeRepositoryMockRecorder) GetRateLimit(ctx, authToken interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRateLimit", reflect.TypeOf((*MockMemeRepository)(nil).GetRateLimit), ctx, authToken)
+}
+
+// GetTokenBalance mocks base method.
+func (m *MockMemeRepository) GetTokenBalance(ctx context.Context, authToken string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTokenBalance", ctx, authToken)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTokenBalance indicates an expected call of GetTokenBalance.
+func (mr *MockMemeRepositoryMockRecorder) GetTokenBalance(ctx, authToken interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTokenBalance", reflect.TypeOf((*MockMemeRepository)(nil).GetTokenBalance), ctx, authToken)
+}
+
+// ListLedgerEntries mocks base method.
+func (m *MockMemeRepository) ListLedgerEntries(ctx context.Context, authToken string, before int64, limit int) ([]store.LedgerEntry, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListLedgerEntries", ctx, authToken, before, limit)
+	ret0, _ := ret[0].([]store.LedgerEntry)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListLedgerEntries indicates an expected call of ListLedgerEntries.
+func (mr *MockMemeRepositoryMockRecorder) ListLedgerEntries(ctx, authToken, before, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListLedgerEntries", reflect.TypeOf((*MockMemeRepository)(nil).ListLedgerEntries), ctx, authToken, before, limit)
+}
+
+// LogAPICall mocks base method.
+func (m *MockMemeRepository) LogAPICall(ctx context.Context, authToken string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LogAPICall", ctx, authToken)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// LogAPICall indicates an expected call of LogAPICall.
+func (mr *MockMemeRepositoryMockRecorder) LogAPICall(ctx, authToken interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LogAPICall", reflect.TypeOf((*MockMemeRepository)(nil).LogAPICall), ctx, authToken)
+}
+
+// RefundToken mocks base method.
+func (m *MockMemeRepository) RefundToken(ctx context.Context, authToken string, meta store.LedgerMeta) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RefundToken", ctx, authToken, meta)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RefundToken indicates an expected call of RefundToken.
+func (mr *MockMemeRepositoryMockRecorder) RefundToken(ctx, authToken, meta interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RefundToken", reflect.TypeOf((*MockMemeRepository)(nil).RefundToken), ctx, authToken, meta)
+}
+
+// ReserveToken mocks base method.
+func (m *MockMemeRepository) ReserveToken(ctx context.Context, authToken string, meta store.LedgerMeta) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReserveToken", ctx, authToken, meta)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReserveToken indicates an expected call of ReserveToken.
+func (mr *MockMemeRepositoryMockRecorder) ReserveToken(ctx, authToken, meta interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReserveToken", reflect.TypeOf((*MockMemeRepository)(nil).ReserveToken), ctx, authToken, meta)
+}
+
+// SearchMemes mocks base method.
+func (m *MockMemeRepository) SearchMemes(ctx context.Context, query string, location *geo.Point, limit int) ([]store.Meme, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SearchMemes", ctx, query, location, limit)
+	ret0, _ := ret[0].([]store.Meme)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SearchMemes indicates an expected call of SearchMemes.
+func (mr *MockMemeRepositoryMockRecorder) SearchMemes(ctx, query, location, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SearchMemes", reflect.TypeOf((*MockMemeRepository)(nil).SearchMemes), ctx, query, location, limit)
+}
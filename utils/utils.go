@@ -1,12 +1,15 @@
 package utils
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
-	"math/rand"
+	mrand "math/rand"
 	"time"
 )
 
-// generateRandomMeme is a placeholder for meme generation logic.
+// GenerateRandomMeme is a placeholder meme generator, used only while the
+// meme catalog is empty.
 func GenerateRandomMeme(query string) string {
 	memes := []string{
 		"One does not simply walk into Mordor.",
@@ -19,6 +22,17 @@ func GenerateRandomMeme(query string) string {
 		memes = append(memes, fmt.Sprintf("When you search for '%s' and find the perfect meme.", query))
 	}
 
-	rand.Seed(time.Now().UnixNano())
-	return memes[rand.Intn(len(memes))]
+	mrand.Seed(time.Now().UnixNano())
+	return memes[mrand.Intn(len(memes))]
+}
+
+// NewReferenceID returns a random identifier suitable for tagging ledger
+// entries and other records that need to be correlated later.
+func NewReferenceID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand only fails if the OS entropy source is broken.
+		panic(err)
+	}
+	return hex.EncodeToString(b)
 }